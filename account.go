@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"site/login"
+	"site/views"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// APIToken — персональный токен пользователя (без самого секрета)
+type APIToken struct {
+	Id         int
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+type AccountData struct {
+	Email           string
+	Tokens          []APIToken
+	Scopes          []string
+	NewToken        string
+	Error           string
+	IsAuthenticated bool
+	IsAdmin         bool
+}
+
+// accountHandler — GET /account: API-токены пользователя
+func accountHandler(w http.ResponseWriter, r *http.Request) {
+	renderAccount(w, r, http.StatusOK, AccountData{})
+}
+
+// renderAccount показывает страницу аккаунта; data дополняется списком токенов
+func renderAccount(w http.ResponseWriter, r *http.Request, status int, data AccountData) {
+	email := login.UserEmail(r)
+	if email == "" {
+		http.Redirect(w, r, "/main", http.StatusSeeOther)
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(
+		`SELECT id, name, scopes, created_at, last_used_at, revoked_at
+           FROM api_tokens WHERE user_email = $1 ORDER BY created_at DESC`,
+		email,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения токенов", err))
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.Id, &t.Name, pq.Array(&t.Scopes), &t.CreatedAt, &t.LastUsedAt, &t.RevokedAt); err != nil {
+			writeError(w, r, views.Internal("Ошибка сканирования токена", err))
+			return
+		}
+		data.Tokens = append(data.Tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, views.Internal("Ошибка после обхода токенов", err))
+		return
+	}
+
+	data.Email = email
+	data.Scopes = login.Scopes
+	data.IsAuthenticated = true
+	data.IsAdmin = login.IsAdmin(r)
+
+	render(w, r, status, "account", data)
+}
+
+// createTokenHandler — POST /account/tokens: выпускает токен и показывает его один раз
+func createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	email := login.UserEmail(r)
+	if email == "" {
+		writeError(w, r, views.Unauthorized("Нужно войти"))
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, views.BadRequest("Ошибка разбора формы"))
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	var scopes []string
+	for _, s := range login.Scopes {
+		for _, v := range r.Form["scope"] {
+			if v == s {
+				scopes = append(scopes, s)
+				break
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		renderAccount(w, r, http.StatusBadRequest, AccountData{Error: "Выберите хотя бы одну область доступа"})
+		return
+	}
+
+	token, hash, err := login.NewToken()
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка генерации токена", err))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	_, err = db.Exec(
+		"INSERT INTO api_tokens (user_email, name, token_hash, scopes) VALUES ($1, $2, $3, $4)",
+		email, name, hash, pq.Array(scopes),
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка сохранения токена", err))
+		return
+	}
+
+	// Без редиректа: токен не должен попасть ни в URL, ни в сессию
+	renderAccount(w, r, http.StatusCreated, AccountData{NewToken: token})
+}
+
+// revokeTokenHandler — POST /account/tokens/{id}/revoke
+func revokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	email := login.UserEmail(r)
+	if email == "" {
+		writeError(w, r, views.Unauthorized("Нужно войти"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	// Чужой токен отозвать нельзя: условие по user_email
+	res, err := db.Exec(
+		"UPDATE api_tokens SET revoked_at = now() WHERE id = $1 AND user_email = $2 AND revoked_at IS NULL",
+		mux.Vars(r)["id"], email,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка отзыва токена", err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, r, views.NotFound("Токен не найден"))
+		return
+	}
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
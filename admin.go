@@ -0,0 +1,437 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"site/handlers"
+	"site/login"
+	"site/views"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// adminListLimit — сколько последних записей показывает каждый раздел админки
+const adminListLimit = 200
+
+// AdminUser — пользователь по данным regist (регистрация) и users (учётная запись)
+type AdminUser struct {
+	Email      string
+	Role       string
+	Registered bool // есть запись в regist
+	Confirmed  bool // код подтверждён — есть учётная запись в users или отметка в regist
+	HasAccount bool // есть запись в users — может войти
+	BannedAt   *time.Time
+}
+
+type AdminPost struct {
+	Id            int
+	Title         string
+	CreatedAt     time.Time
+	UnpublishedAt *time.Time // снята с публикации модератором
+	DeletedAt     *time.Time // в корзине
+	Comments      int
+}
+
+type AdminComment struct {
+	Comment
+	PostTitle string
+}
+
+type AdminFile struct {
+	Id        int
+	Name      string
+	MimeType  string
+	Size      sql.NullInt64
+	CreatedAt time.Time
+	Refs      int
+}
+
+// AdminCounts — сводка для вкладок админки
+type AdminCounts struct {
+	Users, Unconfirmed, Banned, Posts, Comments, Files int
+}
+
+type AdminData struct {
+	Section         string // users, posts, comments, files
+	Counts          AdminCounts
+	Users           []AdminUser
+	Posts           []AdminPost
+	Comments        []AdminComment
+	Files           []AdminFile
+	Limit           int
+	Message         string
+	ResendFailed    []string // адреса, на которые последняя повторная отправка кода не ушла
+	IsAuthenticated bool
+	IsEditor        bool
+}
+
+// requireAdmin пускает только роль admin; остальным — 403
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if !login.IsAdmin(r) {
+		writeError(w, r, views.Forbidden("Раздел доступен только администраторам"))
+		return false
+	}
+	return true
+}
+
+// adminIndexHandler — GET /admin
+func adminIndexHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+}
+
+// adminHandler — GET /admin/{section}: список пользователей, постов, комментариев или файлов
+func adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	data := AdminData{
+		Section:         mux.Vars(r)["section"],
+		Limit:           adminListLimit,
+		Message:         r.URL.Query().Get("done"),
+		IsAuthenticated: true,
+		IsEditor:        true,
+	}
+	if data.Counts, err = loadAdminCounts(db); err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения сводки", err))
+		return
+	}
+	switch data.Section {
+	case "users":
+		data.Users, err = loadAdminUsers(db)
+		data.ResendFailed = handlers.ResendFailures()
+	case "posts":
+		data.Posts, err = loadAdminPosts(db)
+	case "comments":
+		data.Comments, err = loadAdminComments(db)
+	case "files":
+		data.Files, err = loadAdminFiles(db)
+	}
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения списка", err))
+		return
+	}
+	render(w, r, http.StatusOK, "admin", data)
+}
+
+func loadAdminCounts(db *DB) (AdminCounts, error) {
+	var c AdminCounts
+	err := db.QueryRow(
+		`SELECT (SELECT count(*) FROM (SELECT email FROM regist UNION SELECT email FROM users) e),
+                (SELECT count(DISTINCT r.email) FROM regist r
+                  WHERE NOT r.confirmed AND NOT EXISTS (SELECT 1 FROM users u WHERE u.email = r.email)),
+                (SELECT count(*) FROM users WHERE banned_at IS NOT NULL),
+                (SELECT count(*) FROM post),
+                (SELECT count(*) FROM comments),
+                (SELECT count(*) FROM files)`,
+	).Scan(&c.Users, &c.Unconfirmed, &c.Banned, &c.Posts, &c.Comments, &c.Files)
+	return c, err
+}
+
+// loadAdminUsers сводит regist и users по email: неподтверждённые регистрации,
+// подтверждённые учётные записи и учётные записи без регистрации (созданные вручную).
+// Подтверждённым считается адрес с учётной записью: форма кода создаёт её в users.
+func loadAdminUsers(db *DB) ([]AdminUser, error) {
+	rows, err := db.Query(
+		`SELECT COALESCE(u.email, r.email), COALESCE(u.role, ''),
+                r.email IS NOT NULL, u.email IS NOT NULL OR COALESCE(r.confirmed, false),
+                u.email IS NOT NULL, u.banned_at
+           FROM users u
+           FULL OUTER JOIN (SELECT DISTINCT ON (email) email, confirmed FROM regist ORDER BY email, confirmed DESC) r
+             ON r.email = u.email
+          ORDER BY u.banned_at IS NULL, u.email IS NOT NULL OR COALESCE(r.confirmed, false), 1
+          LIMIT $1`,
+		adminListLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []AdminUser
+	for rows.Next() {
+		var u AdminUser
+		if err := rows.Scan(&u.Email, &u.Role, &u.Registered, &u.Confirmed, &u.HasAccount, &u.BannedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func loadAdminPosts(db *DB) ([]AdminPost, error) {
+	rows, err := db.Query(
+		`SELECT p.id, p.title, p.created_at, p.unpublished_at, p.deleted_at,
+                (SELECT count(*) FROM comments c WHERE c.post_id = p.id)
+           FROM post p ORDER BY p.created_at DESC, p.id DESC LIMIT $1`,
+		adminListLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []AdminPost
+	for rows.Next() {
+		var p AdminPost
+		if err := rows.Scan(&p.Id, &p.Title, &p.CreatedAt, &p.UnpublishedAt, &p.DeletedAt, &p.Comments); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func loadAdminComments(db *DB) ([]AdminComment, error) {
+	rows, err := db.Query(
+		`SELECT c.id, c.post_id, c.user_email, c.content, c.created_at, COALESCE(p.title, '')
+           FROM comments c LEFT JOIN post p ON p.id = c.post_id
+          ORDER BY c.created_at DESC, c.id DESC LIMIT $1`,
+		adminListLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []AdminComment
+	for rows.Next() {
+		var c AdminComment
+		if err := rows.Scan(&c.Id, &c.PostID, &c.UserEmail, &c.Content, &c.CreatedAt, &c.PostTitle); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func loadAdminFiles(db *DB) ([]AdminFile, error) {
+	rows, err := db.Query(
+		`SELECT f.id, f.name, f.mime_type, f.size, f.created_at, rc.refs
+           FROM files f JOIN file_ref_counts rc ON rc.file_id = f.id
+          ORDER BY f.created_at DESC, f.id DESC LIMIT $1`,
+		adminListLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []AdminFile
+	for rows.Next() {
+		var f AdminFile
+		if err := rows.Scan(&f.Id, &f.Name, &f.MimeType, &f.Size, &f.CreatedAt, &f.Refs); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// adminActionHandler — POST /admin/{section}: массовое действие action над отмеченными строками
+// (поле selected). После выполнения — редирект обратно в раздел с итогом.
+func adminActionHandler(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, views.BadRequest("Ошибка разбора формы"))
+		return
+	}
+	section := mux.Vars(r)["section"]
+	action := r.FormValue("action")
+	selected := r.Form["selected"]
+	if len(selected) == 0 {
+		http.Redirect(w, r, "/admin/"+section+"?done="+url.QueryEscape("Ничего не выбрано"), http.StatusSeeOther)
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	var done string
+	switch section + "/" + action {
+	case "users/ban":
+		done, err = banUsers(db, selected, login.UserEmail(r))
+	case "users/unban":
+		done, err = execCount(db, "Разблокировано: %d",
+			"UPDATE users SET banned_at = NULL WHERE email = ANY($1) AND banned_at IS NOT NULL", pq.Array(selected))
+	case "users/resend":
+		// Письма уходят в фоне (RunResendQueue); не дошедшие видны в разделе пользователей
+		var n int
+		n, err = handlers.QueueResends(r.Context(), db.DB, selected)
+		done = fmt.Sprintf("Поставлено в очередь писем: %d", n)
+	case "posts/unpublish", "posts/publish", "posts/trash", "posts/restore", "comments/delete":
+		ids, convErr := atoiAll(selected)
+		if convErr != nil {
+			writeError(w, r, views.BadRequest("Некорректный ID"))
+			return
+		}
+		switch action {
+		case "unpublish":
+			// Снятая с публикации статья пропадает из лент и списков, но не удаляется
+			done, err = execCount(db, "Снято с публикации: %d",
+				"UPDATE post SET unpublished_at = now() WHERE id = ANY($1) AND unpublished_at IS NULL", pq.Array(ids))
+		case "publish":
+			done, err = execCount(db, "Опубликовано снова: %d",
+				"UPDATE post SET unpublished_at = NULL WHERE id = ANY($1) AND unpublished_at IS NOT NULL", pq.Array(ids))
+		case "trash":
+			// Через TRASH_RETENTION_DAYS пост из корзины удалит runTrashPurger
+			done, err = execCount(db, "Перенесено в корзину: %d",
+				"UPDATE post SET deleted_at = now() WHERE id = ANY($1) AND deleted_at IS NULL", pq.Array(ids))
+		case "restore":
+			done, err = execCount(db, "Возвращено из корзины: %d",
+				"UPDATE post SET deleted_at = NULL WHERE id = ANY($1) AND deleted_at IS NOT NULL", pq.Array(ids))
+		case "delete":
+			done, err = execCount(db, "Удалено комментариев: %d",
+				"DELETE FROM comments WHERE id = ANY($1)", pq.Array(ids))
+		}
+	default:
+		writeError(w, r, views.BadRequest("Неизвестное действие"))
+		return
+	}
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка выполнения действия", err))
+		return
+	}
+
+	logged := selected
+	if section == "users" {
+		// В разделе пользователей выбраны адреса — в журнал идут их хэши
+		logged = make([]string, len(selected))
+		for i, email := range selected {
+			logged[i] = views.LogEmail(email)
+		}
+	}
+	slog.Info("admin action", "request_id", views.RequestID(r.Context()), "admin", views.LogEmail(login.UserEmail(r)),
+		"section", section, "action", action, "selected", strings.Join(logged, ","), "result", done)
+	http.Redirect(w, r, "/admin/"+section+"?done="+url.QueryEscape(done), http.StatusSeeOther)
+}
+
+// banUsers блокирует пользователей и отзывает их API-токены. Себя заблокировать нельзя,
+// чтобы не остаться без администратора: self убирается из списка.
+func banUsers(db *DB, emails []string, self string) (string, error) {
+	emails = slices.DeleteFunc(slices.Clone(emails), func(email string) bool {
+		return strings.EqualFold(email, self)
+	})
+	if len(emails) == 0 {
+		return "Заблокировано: 0", nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE users SET banned_at = now() WHERE email = ANY($1) AND banned_at IS NULL", pq.Array(emails))
+	if err != nil {
+		return "", err
+	}
+	n, _ := res.RowsAffected()
+	if _, err := tx.Exec(
+		"UPDATE api_tokens SET revoked_at = now() WHERE user_email = ANY($1) AND revoked_at IS NULL",
+		pq.Array(emails),
+	); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Заблокировано: %d", n), tx.Commit()
+}
+
+// execCount выполняет запрос и описывает число затронутых строк по формату format
+func execCount(db *DB, format, query string, args ...any) (string, error) {
+	res, err := db.Exec(query, args...)
+	if err != nil {
+		return "", err
+	}
+	n, _ := res.RowsAffected()
+	return fmt.Sprintf(format, n), nil
+}
+
+// atoiAll разбирает ID строк из формы; ID — целые числа больше нуля
+func atoiAll(values []string) ([]int, error) {
+	ids := make([]int, len(values))
+	for i, v := range values {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		if id <= 0 {
+			return nil, fmt.Errorf("некорректный ID %q", v)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// sessionCheckInterval — как часто пользователь сессии сверяется с users,
+// SESSION_CHECK_INTERVAL (по умолчанию 30s)
+var sessionCheckInterval = sync.OnceValue(func() time.Duration {
+	return envDuration("SESSION_CHECK_INTERVAL", 30*time.Second)
+})
+
+// activeSession — middleware маршрутизатора: пользователь куки-сессии сверяется с users
+// не реже раза в sessionCheckInterval (время проверки хранится в самой сессии).
+// Заблокированный (или удалённый) выходит из системы, а новая роль записывается в сессию —
+// изменения из админки действуют без повторного входа.
+func activeSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := login.CurrentPrincipal(r)
+		if p == nil || strings.HasPrefix(r.URL.Path, "/css/") ||
+			time.Since(login.SessionCheckedAt(r)) < sessionCheckInterval() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		db, err := requestDB(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var role string
+		var banned bool
+		err = db.QueryRow("SELECT role, banned_at IS NOT NULL FROM users WHERE email = $1", p.Email).Scan(&role, &banned)
+		switch {
+		case err == sql.ErrNoRows || err == nil && banned:
+			slog.Info("session ended for banned or removed user", "request_id", views.RequestID(r.Context()), "user", views.LogEmail(p.Email))
+			if err := login.EndSession(w, r); err != nil {
+				slog.Error("ending session failed", "request_id", views.RequestID(r.Context()), "err", err)
+			}
+			r = login.WithPrincipal(r, nil)
+		case err != nil:
+			// БД недоступна — страница всё равно сообщит об ошибке, сессию не трогаем
+			slog.Warn("session check failed", "request_id", views.RequestID(r.Context()), "err", err)
+		default:
+			if err := login.MarkSessionChecked(w, r, role, time.Now()); err != nil {
+				slog.Warn("saving session check failed", "request_id", views.RequestID(r.Context()), "err", err)
+			}
+			if role != p.Role {
+				r = login.WithPrincipal(r, &login.Principal{Email: p.Email, Role: role})
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
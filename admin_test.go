@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"site/handlers"
+	"site/login"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// userRow отвечает на проверку activeSession строкой users с ролью role
+func userRow(role string, banned bool) func(string, []driver.Value) fakeResult {
+	return func(query string, args []driver.Value) fakeResult {
+		if strings.Contains(query, "FROM users WHERE email") {
+			return fakeResult{Cols: []string{"role", "banned"}, Rows: [][]driver.Value{{role, banned}}}
+		}
+		return fakeResult{Err: errors.New("unexpected query: " + query)}
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	rtr := newRouter(nil, nil, nil)
+	form := url.Values{"action": {"ban"}, "selected": {"victim@example.com"}}.Encode()
+
+	for _, user := range []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"guest", nil},
+		{"editor", sessionCookie(t, "editor@example.com", "editor", time.Time{})},
+	} {
+		for _, section := range []string{"users", "posts", "comments", "files"} {
+			for _, method := range []string{"GET", "POST"} {
+				if method == "POST" && section == "files" {
+					continue // для файлов действий нет
+				}
+				t.Run(user.name+" "+method+" "+section, func(t *testing.T) {
+					db := useFakeDB(t, userRow("editor", false))
+					var body io.Reader
+					if method == "POST" {
+						body = strings.NewReader(form)
+					}
+					r := httptest.NewRequest(method, "/admin/"+section, body)
+					r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+					if user.cookie != nil {
+						r.AddCookie(user.cookie)
+					}
+					rec := httptest.NewRecorder()
+					rtr.ServeHTTP(rec, r)
+					if rec.Code != http.StatusForbidden {
+						t.Errorf("status %d, want 403", rec.Code)
+					}
+					for _, q := range db.SQL() {
+						if !strings.Contains(q, "FROM users WHERE email") {
+							t.Errorf("query ran before the admin check: %s", q)
+						}
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestAtoiAll(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []int
+		ok   bool
+	}{
+		{[]string{"1", "42"}, []int{1, 42}, true},
+		{[]string{}, []int{}, true},
+		{[]string{"1", "abc"}, nil, false},
+		{[]string{""}, nil, false},
+		{[]string{"1.5"}, nil, false},
+		{[]string{"0"}, nil, false},
+		{[]string{"-3"}, nil, false},
+		{[]string{"99999999999999999999"}, nil, false},
+		{[]string{"1; DROP TABLE post"}, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := atoiAll(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("atoiAll(%q) error = %v, want ok = %v", tt.in, err, tt.ok)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("atoiAll(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBanUsers(t *testing.T) {
+	f := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.HasPrefix(query, "UPDATE users") {
+			return fakeResult{Affected: 2}
+		}
+		return fakeResult{}
+	})
+	pool, _ := dbPool()
+	db := &DB{DB: pool, ctx: context.Background()}
+
+	done, err := banUsers(db, []string{"a@example.com", "Admin@Example.com", "b@example.com"}, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done != "Заблокировано: 2" {
+		t.Errorf("done = %q", done)
+	}
+
+	queries := f.Queries()
+	if len(queries) != 4 || queries[0].SQL != "BEGIN" || queries[3].SQL != "COMMIT" {
+		t.Fatalf("queries = %q, want BEGIN, two updates, COMMIT", f.SQL())
+	}
+	if !strings.HasPrefix(queries[1].SQL, "UPDATE users SET banned_at") {
+		t.Errorf("first update: %s", queries[1].SQL)
+	}
+	if !strings.HasPrefix(queries[2].SQL, "UPDATE api_tokens SET revoked_at") {
+		t.Errorf("tokens are not revoked: %s", queries[2].SQL)
+	}
+	want := `{"a@example.com","b@example.com"}`
+	for _, q := range queries[1:3] {
+		if len(q.Args) != 1 || q.Args[0] != want {
+			t.Errorf("%s: args %v, want %s without self", q.SQL, q.Args, want)
+		}
+	}
+
+	// Только себя — ничего не делаем
+	f.Reset()
+	done, err = banUsers(db, []string{"admin@example.com"}, "admin@example.com")
+	if err != nil || done != "Заблокировано: 0" {
+		t.Errorf("banning only self: %q, %v", done, err)
+	}
+	if qs := f.SQL(); len(qs) != 0 {
+		t.Errorf("banning only self ran queries: %q", qs)
+	}
+}
+
+func TestActiveSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		role      string // роль в сессии
+		checkedAt time.Time
+		respond   func(string, []driver.Value) fakeResult
+		wantUser  bool
+		wantRole  string
+		wantQuery bool
+		wantEnded bool
+	}{
+		{name: "banned", role: "user", respond: userRow("user", true), wantQuery: true, wantEnded: true},
+		{
+			name: "removed", role: "user", wantQuery: true, wantEnded: true,
+			respond: func(string, []driver.Value) fakeResult { return fakeResult{Cols: []string{"role", "banned"}} },
+		},
+		{name: "role changed", role: "user", respond: userRow("editor", false), wantUser: true, wantRole: "editor", wantQuery: true},
+		{name: "active", role: "admin", respond: userRow("admin", false), wantUser: true, wantRole: "admin", wantQuery: true},
+		{name: "recently checked", role: "user", checkedAt: time.Now(), respond: userRow("user", true), wantUser: true, wantRole: "user"},
+		{
+			name: "db down", role: "user", wantUser: true, wantRole: "user", wantQuery: true,
+			respond: func(string, []driver.Value) fakeResult { return fakeResult{Err: errors.New("connection refused")} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := useFakeDB(t, tt.respond)
+			var got *login.Principal
+			h := activeSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = login.CurrentPrincipal(r)
+			}))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.AddCookie(sessionCookie(t, "user@example.com", tt.role, tt.checkedAt))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if (got != nil) != tt.wantUser {
+				t.Fatalf("principal = %+v, want user = %v", got, tt.wantUser)
+			}
+			if got != nil && got.Role != tt.wantRole {
+				t.Errorf("role %q, want %q", got.Role, tt.wantRole)
+			}
+			if queried := len(db.SQL()) > 0; queried != tt.wantQuery {
+				t.Errorf("queried users = %v, want %v", queried, tt.wantQuery)
+			}
+			ended := false
+			for _, c := range rec.Result().Cookies() {
+				if c.Name == "session-name" && c.MaxAge < 0 {
+					ended = true
+				}
+			}
+			if ended != tt.wantEnded {
+				t.Errorf("session ended = %v, want %v", ended, tt.wantEnded)
+			}
+		})
+	}
+}
+
+func TestActiveSessionCachesCheck(t *testing.T) {
+	db := useFakeDB(t, userRow("user", false))
+	h := activeSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(sessionCookie(t, "user@example.com", "user", time.Time{}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	// Следующий запрос приходит с обновлённой кукой: время проверки в ней, БД не нужна
+	var updated *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == "session-name" {
+			updated = c
+		}
+	}
+	if updated == nil {
+		t.Fatal("checked session was not saved")
+	}
+	r = httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(updated)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if n := len(db.SQL()); n != 1 {
+		t.Errorf("users queried %d times, want once", n)
+	}
+}
+
+func TestQueueResends(t *testing.T) {
+	// Без настроек SMTP каждая отправка проваливается
+	for _, name := range []string{"SMTP_FROM", "SMTP_PASSWORD", "SMTP_HOST", "SMTP_PORT"} {
+		t.Setenv(name, "")
+	}
+	f := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		if strings.Contains(query, "FROM regist") {
+			return fakeResult{Cols: []string{"email"}, Rows: [][]driver.Value{{"a@example.com"}, {"b@example.com"}}}
+		}
+		return fakeResult{}
+	})
+	pool, _ := dbPool()
+
+	n, err := handlers.QueueResends(context.Background(), pool, []string{"a@example.com", "b@example.com", "confirmed@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("queued %d, want 2", n)
+	}
+	if q := f.SQL()[0]; !strings.Contains(q, "NOT EXISTS (SELECT 1 FROM users") {
+		t.Errorf("addresses with an account are not excluded: %s", q)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		handlers.RunResendQueue(ctx, pool)
+		close(stopped)
+	}()
+	want := []string{"a@example.com", "b@example.com"}
+	for deadline := time.Now().Add(5 * time.Second); !reflect.DeepEqual(handlers.ResendFailures(), want); {
+		if time.Now().After(deadline) {
+			t.Fatalf("ResendFailures() = %v, want %v", handlers.ResendFailures(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-stopped
+
+	for _, q := range f.SQL() {
+		if strings.HasPrefix(q, "UPDATE") {
+			t.Errorf("confirmation code changed although the email was not sent: %s", q)
+		}
+	}
+}
+
+func TestAdminPostActions(t *testing.T) {
+	tests := []struct {
+		action string
+		query  string
+		done   string
+	}{
+		{"unpublish", "UPDATE post SET unpublished_at = now()", "Снято с публикации: 1"},
+		{"publish", "UPDATE post SET unpublished_at = NULL", "Опубликовано снова: 1"},
+		{"trash", "UPDATE post SET deleted_at = now()", "Перенесено в корзину: 1"},
+		{"restore", "UPDATE post SET deleted_at = NULL", "Возвращено из корзины: 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			f := useFakeDB(t, func(string, []driver.Value) fakeResult { return fakeResult{Affected: 1} })
+			form := url.Values{"action": {tt.action}, "selected": {"7"}}.Encode()
+			r := httptest.NewRequest("POST", "/admin/posts", strings.NewReader(form))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r = mux.SetURLVars(r, map[string]string{"section": "posts"})
+			r = login.WithPrincipal(r, &login.Principal{Email: "admin@example.com", Role: "admin"})
+			rec := httptest.NewRecorder()
+			adminActionHandler(rec, r)
+
+			if rec.Code != http.StatusSeeOther {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			if loc := rec.Header().Get("Location"); loc != "/admin/posts?done="+url.QueryEscape(tt.done) {
+				t.Errorf("Location %q, want done = %q", loc, tt.done)
+			}
+			qs := f.SQL()
+			if len(qs) != 1 || !strings.HasPrefix(qs[0], tt.query) {
+				t.Errorf("queries %q, want %s", qs, tt.query)
+			}
+		})
+	}
+}
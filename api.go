@@ -0,0 +1,578 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"site/login"
+	"site/views"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/lib/pq"
+)
+
+// JSON API /api/v1 для мобильного приложения и интеграций. Проверки и запись в БД —
+// те же, что у HTML-форм (см. posts.go); ошибки всегда приходят в виде apiError.
+
+// maxAPIBodyBytes — предел тела JSON-запроса; файлы загружаются отдельно через /api/v1/files
+const maxAPIBodyBytes = 4 << 20
+
+// apiError — тело любого ответа с ошибкой: {"error": {"status": 404, "message": "..."}}
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+type apiPost struct {
+	ID           int        `json:"id"`
+	Title        string     `json:"title"`
+	Anons        string     `json:"anons"`
+	FullText     string     `json:"full_text,omitempty"`
+	FullTextHTML string     `json:"full_text_html,omitempty"`
+	CoverURL     string     `json:"cover_url,omitempty"`
+	Media        []apiMedia `json:"media,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	URL          string     `json:"url"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type apiMedia struct {
+	ID       int    `json:"id"`
+	FileID   int    `json:"file_id"`
+	Position int    `json:"position"`
+	Caption  string `json:"caption"`
+	Alt      string `json:"alt"`
+	URL      string `json:"url"`
+	ThumbURL string `json:"thumb_url"`
+}
+
+type apiComment struct {
+	ID        int       `json:"id"`
+	PostID    int       `json:"post_id"`
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiFile struct {
+	ID       int    `json:"id"`
+	URL      string `json:"url"`
+	ThumbURL string `json:"thumb_url"`
+}
+
+// apiPostInput — тело POST и PUT /api/v1/posts/{id}. Media — id файлов из /api/v1/files:
+// при создании это вся галерея, при правке — файлы, добавляемые в её конец.
+// RemoveMedia — id элементов галереи, которые убрать (только при правке).
+type apiPostInput struct {
+	PostInput
+	Media       []int `json:"media"`
+	RemoveMedia []int `json:"remove_media"`
+}
+
+type apiCommentInput struct {
+	Content string `json:"content"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: apiErrorBody{Status: status, Message: message}})
+}
+
+// isAPIRequest — запрос к JSON API: ошибки отдаются в JSON, а не страницей
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/")
+}
+
+// writeAPIErr переводит ошибку операции в ответ по тем же правилам, что и страницы ошибок
+// (views.Classify): ошибки ввода и загрузки — с их кодом, sql.ErrNoRows — 404, остальное — 500
+// без подробностей, которые уходят в лог вместе с номером запроса
+func writeAPIErr(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := views.Classify(err)
+	if status >= 500 {
+		views.LogError(r, err)
+	}
+	writeAPIError(w, status, message)
+}
+
+// decodeJSON читает тело запроса в v; неизвестные поля и лишние данные — ошибка ввода
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return &UploadError{Status: http.StatusRequestEntityTooLarge, Message: "Тело запроса слишком большое"}
+		}
+		return &InputError{Message: "Некорректный JSON: " + err.Error()}
+	}
+	if dec.Decode(&struct{}{}) != io.EOF {
+		return &InputError{Message: "Некорректный JSON: лишние данные после объекта"}
+	}
+	return nil
+}
+
+// apiAuth — общий для сессий и API-токенов middleware: определяет пользователя
+// (см. login.Authenticate) и кладёт его в контекст запроса
+func apiAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pool, err := dbPool()
+		if err != nil {
+			writeAPIErr(w, r, err)
+			return
+		}
+		p, err := login.Authenticate(pool, r)
+		if errors.Is(err, login.ErrInvalidToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+			writeAPIError(w, http.StatusUnauthorized, err.Error())
+			return
+		} else if err != nil {
+			writeAPIErr(w, r, err)
+			return
+		}
+		if p != nil && p.TokenID == 0 && !sessionRequestAllowed(r) {
+			writeAPIError(w, http.StatusForbidden, "Запрос с сессией браузера должен быть JSON (Content-Type: application/json) или нести заголовок X-Requested-With")
+			return
+		}
+		if p != nil {
+			r = login.WithPrincipal(r, p)
+			setRequestUser(r, p.Email)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sessionRequestAllowed защищает от CSRF изменения по cookie сессии. Чужая страница может
+// отправить форму (urlencoded, multipart, text/plain) с cookie посетителя, но не может без
+// CORS-preflight поставить Content-Type: application/json или свой заголовок. Токены
+// в Authorization браузер сам не подставляет, поэтому для них проверка не нужна.
+func sessionRequestAllowed(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if r.Header.Get("X-Requested-With") != "" {
+		return true
+	}
+	ct, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && ct == "application/json"
+}
+
+// apiRequireScope пропускает только авторизованных пользователей, чей токен имеет область scope
+func apiRequireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := login.CurrentPrincipal(r)
+		if p == nil {
+			writeAPIError(w, http.StatusUnauthorized, "Требуется авторизация")
+			return
+		}
+		if !p.HasScope(scope) {
+			writeAPIError(w, http.StatusForbidden, "У токена нет области "+scope)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// apiReadable — чтение открыто гостям, но токен без области read получает 403
+func apiReadable(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p := login.CurrentPrincipal(r); p != nil && !p.HasScope(login.ScopeRead) {
+			writeAPIError(w, http.StatusForbidden, "У токена нет области "+login.ScopeRead)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// apiWithDB подключается к БД и передаёт соединение обработчику
+func apiWithDB(h func(w http.ResponseWriter, r *http.Request, db *DB)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		db, err := requestDB(r)
+		if err != nil {
+			writeAPIErr(w, r, views.Internal("Ошибка подключения к БД", err))
+			return
+		}
+		defer db.Close()
+		h(w, r, db)
+	}
+}
+
+func apiPostID(r *http.Request) int {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	return id
+}
+
+func toAPIPost(p Post, media []Media) apiPost {
+	out := apiPost{
+		ID:           p.Id,
+		Title:        p.Title,
+		Anons:        p.Anons,
+		FullText:     p.Full_text,
+		FullTextHTML: string(p.FullTextHTML),
+		Tags:         p.Tags,
+		URL:          fmt.Sprintf("/post/%d", p.Id),
+		CreatedAt:    p.CreatedAt,
+	}
+	for _, m := range media {
+		out.Media = append(out.Media, apiMedia{
+			ID:       m.Id,
+			FileID:   m.FileID,
+			Position: m.Position,
+			Caption:  m.Caption,
+			Alt:      m.Alt,
+			URL:      m.URL("full"),
+			ThumbURL: m.URL("thumb"),
+		})
+	}
+	// Обложка — первое изображение галереи (см. normalizeMedia)
+	if len(media) > 0 {
+		out.CoverURL = media[0].URL("medium")
+	} else if p.PhotoID.Valid {
+		out.CoverURL = fmt.Sprintf("/file/%d", p.PhotoID.Int64)
+	}
+	return out
+}
+
+func toAPIComment(c Comment) apiComment {
+	return apiComment{ID: c.Id, PostID: c.PostID, Author: c.UserEmail, Content: c.Content, CreatedAt: c.CreatedAt}
+}
+
+// checkFiles проверяет, что все id из media — загруженные файлы
+func checkFiles(db *DB, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM files WHERE id = ANY($1)", pq.Array(ids)).Scan(&n); err != nil {
+		return err
+	}
+	if n != len(uniqueInts(ids)) {
+		return &InputError{Message: "В media есть несуществующие файлы"}
+	}
+	return nil
+}
+
+func uniqueInts(ids []int) []int {
+	seen := map[int]bool{}
+	var out []int
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// apiListPosts — GET /api/v1/posts?limit=20&offset=0: анонсы статей, новые первыми
+func apiListPosts(w http.ResponseWriter, r *http.Request, db *DB) {
+	limit, offset := 20, 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 100 {
+			writeAPIError(w, http.StatusBadRequest, "limit должен быть от 1 до 100")
+			return
+		}
+		limit = n
+	}
+	if v := r.URL.Query().Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeAPIError(w, http.StatusBadRequest, "offset должен быть неотрицательным числом")
+			return
+		}
+		offset = n
+	}
+
+	rows, err := db.Query(
+		`SELECT p.id, p.title, p.anons, p.photo_id, p.created_at, COALESCE(LEFT(f.blob_key, 16), '')
+           FROM post p LEFT JOIN files f ON f.id = p.photo_id
+          WHERE p.deleted_at IS NULL AND p.unpublished_at IS NULL
+          ORDER BY p.created_at DESC, p.id DESC
+          LIMIT $1 OFFSET $2`,
+		limit, offset,
+	)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	posts := []apiPost{}
+	for rows.Next() {
+		var p Post
+		var version string
+		if err := rows.Scan(&p.Id, &p.Title, &p.Anons, &p.PhotoID, &p.CreatedAt, &version); err != nil {
+			writeAPIErr(w, r, err)
+			return
+		}
+		var cover []Media
+		if p.PhotoID.Valid {
+			cover = []Media{{FileID: int(p.PhotoID.Int64), Version: version}}
+		}
+		ap := toAPIPost(p, cover)
+		ap.Media = nil
+		posts = append(posts, ap)
+	}
+	if err := rows.Err(); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"posts": posts, "limit": limit, "offset": offset})
+}
+
+// apiGetPost — GET /api/v1/posts/{id}
+func apiGetPost(w http.ResponseWriter, r *http.Request, db *DB) {
+	p, err := loadPost(db, apiPostID(r), login.IsEditor(r))
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	media, err := loadPostMedia(db, p.Id)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIPost(p, media))
+}
+
+// apiCreatePost — POST /api/v1/posts
+func apiCreatePost(w http.ResponseWriter, r *http.Request, db *DB) {
+	var in apiPostInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	if err := checkFiles(db, in.Media); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	id, err := createPost(db, in.PostInput, uniqueInts(in.Media), login.UserEmail(r))
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+
+	apiRespondPost(w, r, db, id, http.StatusCreated)
+}
+
+// apiUpdatePost — PUT /api/v1/posts/{id}: заменяет поля статьи, правит галерею.
+// Править может автор статьи или редактор.
+func apiUpdatePost(w http.ResponseWriter, r *http.Request, db *DB) {
+	id := apiPostID(r)
+	if err := checkPostEditor(db, r, id); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	var in apiPostInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	if err := checkFiles(db, in.Media); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	// Правки галереи в том же виде, что присылает форма edit.html
+	edits := url.Values{}
+	for _, mid := range in.RemoveMedia {
+		edits.Add("remove_media", strconv.Itoa(mid))
+	}
+
+	if err := updatePost(db, id, in.PostInput, edits, uniqueInts(in.Media), login.UserEmail(r)); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+
+	apiRespondPost(w, r, db, id, http.StatusOK)
+}
+
+// apiRespondPost отвечает сохранённой статьёй в том же виде, что GET /api/v1/posts/{id}
+func apiRespondPost(w http.ResponseWriter, r *http.Request, db *DB, id, status int) {
+	p, err := loadPost(db, id, true)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	media, err := loadPostMedia(db, id)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	if status == http.StatusCreated {
+		w.Header().Set("Location", fmt.Sprintf("/api/v1/posts/%d", id))
+	}
+	writeJSON(w, status, toAPIPost(p, media))
+}
+
+// apiDeletePost — DELETE /api/v1/posts/{id}: переносит статью в корзину.
+// Удалить может автор статьи или редактор.
+func apiDeletePost(w http.ResponseWriter, r *http.Request, db *DB) {
+	id := apiPostID(r)
+	if err := checkPostEditor(db, r, id); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	ok, err := trashPost(db, id)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	if !ok {
+		writeAPIErr(w, r, sql.ErrNoRows)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiListComments — GET /api/v1/posts/{id}/comments
+func apiListComments(w http.ResponseWriter, r *http.Request, db *DB) {
+	id := apiPostID(r)
+	var exists bool
+	if err := db.QueryRow("SELECT true FROM post WHERE id = $1 AND deleted_at IS NULL", id).Scan(&exists); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	comments, err := loadComments(db, id)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+
+	out := []apiComment{}
+	for _, c := range comments {
+		out = append(out, toAPIComment(c))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"comments": out})
+}
+
+// apiAddComment — POST /api/v1/posts/{id}/comments
+func apiAddComment(w http.ResponseWriter, r *http.Request, db *DB) {
+	var in apiCommentInput
+	if err := decodeJSON(w, r, &in); err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	c, err := addComment(db, apiPostID(r), login.UserEmail(r), in.Content)
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIComment(c))
+}
+
+// apiUploadFiles — POST /api/v1/files (multipart, поле file, можно несколько):
+// те же ограничения и обработка, что у фото в формах; id файлов передаются в media.
+// С сессией браузера нужен заголовок X-Requested-With (см. sessionRequestAllowed).
+func apiUploadFiles(w http.ResponseWriter, r *http.Request, db *DB) {
+	form, err := parseUploadForm(w, r, uploadLimits())
+	defer form.Cleanup()
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	if len(form.Files["file"]) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "Нет файлов в поле file")
+		return
+	}
+
+	ids, err := storeUploads(db, form.Files["file"])
+	if err != nil {
+		writeAPIErr(w, r, err)
+		return
+	}
+	files := []apiFile{}
+	for _, id := range ids {
+		m := Media{FileID: id}
+		if err := db.QueryRow("SELECT COALESCE(LEFT(blob_key, 16), '') FROM files WHERE id = $1", id).Scan(&m.Version); err != nil {
+			writeAPIErr(w, r, err)
+			return
+		}
+		files = append(files, apiFile{ID: id, URL: m.URL("full"), ThumbURL: m.URL("thumb")})
+	}
+	writeJSON(w, http.StatusCreated, map[string]any{"files": files})
+}
+
+// registerAPIRoutes подключает /api/v1 к роутеру из handlerRequest
+func registerAPIRoutes(rtr *mux.Router) {
+	api := rtr.PathPrefix("/api/v1").Subrouter()
+	api.Use(apiAuth)
+	api.HandleFunc("/posts", apiReadable(apiWithDB(apiListPosts))).Methods("GET")
+	api.HandleFunc("/posts", apiRequireScope(login.ScopeWritePosts, apiWithDB(apiCreatePost))).Methods("POST")
+	api.HandleFunc("/posts/{id:[0-9]+}", apiReadable(apiWithDB(apiGetPost))).Methods("GET")
+	api.HandleFunc("/posts/{id:[0-9]+}", apiRequireScope(login.ScopeWritePosts, apiWithDB(apiUpdatePost))).Methods("PUT")
+	api.HandleFunc("/posts/{id:[0-9]+}", apiRequireScope(login.ScopeWritePosts, apiWithDB(apiDeletePost))).Methods("DELETE")
+	api.HandleFunc("/posts/{id:[0-9]+}/comments", apiReadable(apiWithDB(apiListComments))).Methods("GET")
+	api.HandleFunc("/posts/{id:[0-9]+}/comments", apiRequireScope(login.ScopeWriteComments, apiWithDB(apiAddComment))).Methods("POST")
+	api.HandleFunc("/files", apiRequireScope(login.ScopeWritePosts, apiWithDB(apiUploadFiles))).Methods("POST")
+
+	rtr.HandleFunc("/api/openapi.json", openAPIHandler).Methods("GET")
+
+	// Неизвестные адреса и методы под /api тоже отвечают JSON, а не HTML-страницей.
+	// 405 считаем сами: mux теряет несовпадение метода, если после маршрута идут другие.
+	routes := apiRouteMethods(api)
+	rtr.PathPrefix("/api/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if allowed := routes.allowed(r.URL.Path); len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			writeAPIError(w, http.StatusMethodNotAllowed, "Метод не поддерживается")
+			return
+		}
+		writeAPIError(w, http.StatusNotFound, "Нет такого метода API")
+	})
+}
+
+// apiRoute — регулярное выражение пути маршрута API и его методы
+type apiRoute struct {
+	path    *regexp.Regexp
+	methods []string
+}
+
+type apiRouteTable []apiRoute
+
+// apiRouteMethods один раз, при сборке роутера, компилирует пути всех маршрутов API
+func apiRouteMethods(api *mux.Router) apiRouteTable {
+	var routes apiRouteTable
+	api.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		re, err := route.GetPathRegexp()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		routes = append(routes, apiRoute{path: regexp.MustCompile(re), methods: methods})
+		return nil
+	})
+	return routes
+}
+
+// allowed — методы маршрутов API, путь которых совпадает с path
+func (routes apiRouteTable) allowed(path string) []string {
+	var allowed []string
+	for _, rt := range routes {
+		if rt.path.MatchString(path) {
+			allowed = append(allowed, rt.methods...)
+		}
+	}
+	return allowed
+}
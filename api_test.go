@@ -0,0 +1,136 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"site/login"
+	"strings"
+	"testing"
+)
+
+func TestSessionRequestAllowed(t *testing.T) {
+	tests := []struct {
+		method, contentType, requestedWith string
+		want                               bool
+	}{
+		{"GET", "", "", true},
+		{"HEAD", "", "", true},
+		{"POST", "application/json", "", true},
+		{"POST", "application/json; charset=utf-8", "", true},
+		{"PUT", "Application/JSON", "", true},
+		{"POST", "application/x-www-form-urlencoded", "", false},
+		{"POST", "text/plain", "", false},
+		{"POST", "multipart/form-data; boundary=x", "", false},
+		{"POST", "multipart/form-data; boundary=x", "XMLHttpRequest", true},
+		{"DELETE", "", "", false},
+		{"POST", "application/jsonp", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/v1/posts", strings.NewReader("{}"))
+		if tt.contentType != "" {
+			r.Header.Set("Content-Type", tt.contentType)
+		}
+		if tt.requestedWith != "" {
+			r.Header.Set("X-Requested-With", tt.requestedWith)
+		}
+		if got := sessionRequestAllowed(r); got != tt.want {
+			t.Errorf("%s %q X-Requested-With=%q: got %v, want %v", tt.method, tt.contentType, tt.requestedWith, got, tt.want)
+		}
+	}
+}
+
+// apiTokens — токены для тестов API: Bearer-строка → владелец, роль и области
+var apiTokens = map[string]struct {
+	email, role, scopes string
+}{
+	"author-token": {"author@example.com", "user", "{read,write:posts}"},
+	"other-token":  {"other@example.com", "user", "{read,write:posts}"},
+	"editor-token": {"editor@example.com", "editor", "{read,write:posts}"},
+	"read-token":   {"author@example.com", "user", "{read}"},
+}
+
+// apiFakeDB отвечает на запросы обработчиков статей API: токены из apiTokens,
+// статья 1 написана author@example.com, статья 2 — до истории правок (автор неизвестен),
+// остальных нет
+func apiFakeDB(query string, args []driver.Value) fakeResult {
+	switch {
+	case strings.Contains(query, "FROM api_tokens t"):
+		for token, owner := range apiTokens {
+			if args[0] == login.HashToken(token) {
+				return fakeResult{
+					Cols: []string{"id", "user_email", "role", "scopes"},
+					Rows: [][]driver.Value{{int64(1), owner.email, owner.role, []byte(owner.scopes)}},
+				}
+			}
+		}
+		return fakeResult{Cols: []string{"id", "user_email", "role", "scopes"}}
+	case strings.Contains(query, "FROM post_revisions r"):
+		authors := map[int64]string{1: "author@example.com", 2: ""}
+		if author, ok := authors[args[0].(int64)]; ok {
+			return fakeResult{Cols: []string{"author"}, Rows: [][]driver.Value{{author}}}
+		}
+		return fakeResult{Cols: []string{"author"}}
+	case strings.HasPrefix(query, "UPDATE post SET deleted_at"):
+		return fakeResult{Affected: 1}
+	}
+	return fakeResult{}
+}
+
+func TestAPIPostPermissions(t *testing.T) {
+	rtr := newRouter(nil, nil, nil)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+	}{
+		{"guest update", "PUT", "/api/v1/posts/1", "", `{"title":"x"}`, http.StatusUnauthorized},
+		{"unknown token", "DELETE", "/api/v1/posts/1", "stolen-token", "", http.StatusUnauthorized},
+		{"read-only token update", "PUT", "/api/v1/posts/1", "read-token", `{"title":"x"}`, http.StatusForbidden},
+		{"read-only token delete", "DELETE", "/api/v1/posts/1", "read-token", "", http.StatusForbidden},
+		{"other user update", "PUT", "/api/v1/posts/1", "other-token", `{"title":"x"}`, http.StatusForbidden},
+		{"other user delete", "DELETE", "/api/v1/posts/1", "other-token", "", http.StatusForbidden},
+		{"user deletes post without author", "DELETE", "/api/v1/posts/2", "author-token", "", http.StatusForbidden},
+		{"author deletes", "DELETE", "/api/v1/posts/1", "author-token", "", http.StatusNoContent},
+		{"editor deletes", "DELETE", "/api/v1/posts/1", "editor-token", "", http.StatusNoContent},
+		{"editor deletes post without author", "DELETE", "/api/v1/posts/2", "editor-token", "", http.StatusNoContent},
+		{"missing post update", "PUT", "/api/v1/posts/99", "editor-token", `{"title":"x"}`, http.StatusNotFound},
+		{"missing post delete", "DELETE", "/api/v1/posts/99", "author-token", "", http.StatusNotFound},
+		{"malformed JSON", "PUT", "/api/v1/posts/1", "author-token", `{"title":`, http.StatusBadRequest},
+		{"unknown field", "PUT", "/api/v1/posts/1", "author-token", `{"title":"x","author":"me"}`, http.StatusBadRequest},
+		{"trailing data", "PUT", "/api/v1/posts/1", "author-token", `{"title":"x"} {}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeDB(t, apiFakeDB)
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			rtr.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusNoContent {
+				var body apiError
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Status != tt.status {
+					t.Errorf("body %s: %+v, %v", rec.Body, body, err)
+				}
+			}
+			if tt.status >= 400 {
+				for _, q := range f.SQL() {
+					if strings.HasPrefix(q, "UPDATE post") || strings.HasPrefix(q, "INSERT") {
+						t.Errorf("post changed by a denied request: %s", q)
+					}
+				}
+			}
+		})
+	}
+}
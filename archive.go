@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"site/login"
+	"site/views"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// monthNames — названия месяцев для заголовков («Октябрь 2026»)
+var monthNames = [...]string{"Январь", "Февраль", "Март", "Апрель", "Май", "Июнь",
+	"Июль", "Август", "Сентябрь", "Октябрь", "Ноябрь", "Декабрь"}
+
+// monthNamesGen — названия месяцев в родительном падеже («19 октября 2026»)
+var monthNamesGen = [...]string{"января", "февраля", "марта", "апреля", "мая", "июня",
+	"июля", "августа", "сентября", "октября", "ноября", "декабря"}
+
+// CalendarDay — клетка календаря; Day == 0 — пустая клетка до первого или после последнего дня
+type CalendarDay struct {
+	Day      int
+	Count    int
+	URL      string
+	Selected bool
+	Today    bool
+}
+
+// Calendar — месяц по неделям с понедельника; дни со статьями ведут в архив за день
+type Calendar struct {
+	Title   string
+	URL     string
+	PrevURL string
+	NextURL string
+	Weeks   [][]CalendarDay
+}
+
+// ArchiveMonth — месяц в архиве за год
+type ArchiveMonth struct {
+	Title string
+	URL   string
+	Count int
+}
+
+type ArchiveData struct {
+	Title           string
+	Posts           []Post
+	Months          []ArchiveMonth
+	Calendar        *Calendar
+	YearURL         string
+	IsAuthenticated bool
+	IsEditor        bool
+	Meta            *PageMeta
+}
+
+func archiveMonthURL(t time.Time) string {
+	return fmt.Sprintf("/archive/%04d/%02d", t.Year(), int(t.Month()))
+}
+
+func archiveDayURL(t time.Time) string {
+	return fmt.Sprintf("/archive/%04d/%02d/%02d", t.Year(), int(t.Month()), t.Day())
+}
+
+// loadPostsBetween возвращает опубликованные статьи, созданные в [start, end), новые сверху.
+// Границы переводятся в UTC, в котором хранится created_at.
+func loadPostsBetween(db *DB, start, end time.Time) ([]Post, error) {
+	rows, err := db.Query(
+		`SELECT id, title, anons, full_text, photo_id, created_at
+           FROM post
+          WHERE deleted_at IS NULL AND unpublished_at IS NULL AND created_at >= $1 AND created_at < $2
+          ORDER BY created_at DESC, id DESC`,
+		start.UTC(), end.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var p Post
+		if err := rows.Scan(&p.Id, &p.Title, &p.Anons, &p.Full_text, &p.PhotoID, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// loadPostTimes возвращает время создания статей в [start, end) в часовом поясе сайта —
+// по нему календарь считает статьи за день, а архив за год — за месяц
+func loadPostTimes(db *DB, start, end time.Time) ([]time.Time, error) {
+	rows, err := db.Query(
+		"SELECT created_at FROM post WHERE deleted_at IS NULL AND unpublished_at IS NULL AND created_at >= $1 AND created_at < $2",
+		start.UTC(), end.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t.In(siteLocation()))
+	}
+	return times, rows.Err()
+}
+
+// loadCalendar строит календарь месяца, в котором лежит month; selected — выбранный день или 0
+func loadCalendar(db *DB, month time.Time, selected int) (*Calendar, error) {
+	first := midnight(month.Year(), month.Month(), 1)
+	next := midnight(month.Year(), month.Month()+1, 1)
+
+	times, err := loadPostTimes(db, first, next)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[int]int)
+	for _, t := range times {
+		counts[t.Day()]++
+	}
+
+	now := siteNow()
+	cal := &Calendar{
+		Title:   fmt.Sprintf("%s %d", monthNames[first.Month()-1], first.Year()),
+		URL:     archiveMonthURL(first),
+		PrevURL: archiveMonthURL(midnight(first.Year(), first.Month()-1, 1)),
+		NextURL: archiveMonthURL(next),
+	}
+
+	// Пустые клетки перед первым числом: неделя начинается с понедельника
+	week := make([]CalendarDay, (int(first.Weekday())+6)%7)
+	// День 0 следующего месяца — последний день этого
+	days := time.Date(first.Year(), first.Month()+1, 0, 12, 0, 0, 0, time.UTC).Day()
+	for n := 1; n <= days; n++ {
+		d := midnight(first.Year(), first.Month(), n)
+		day := CalendarDay{
+			Day:      d.Day(),
+			Count:    counts[d.Day()],
+			Selected: d.Day() == selected,
+			Today:    d.Year() == now.Year() && d.YearDay() == now.YearDay(),
+		}
+		if day.Count > 0 {
+			day.URL = archiveDayURL(d)
+		}
+		week = append(week, day)
+		if len(week) == 7 {
+			cal.Weeks = append(cal.Weeks, week)
+			week = nil
+		}
+	}
+	if len(week) > 0 {
+		for len(week) < 7 {
+			week = append(week, CalendarDay{})
+		}
+		cal.Weeks = append(cal.Weeks, week)
+	}
+	return cal, nil
+}
+
+// archivePeriodStart — начало дня year-month-day в часовом поясе сайта (см. midnight).
+// time.Date нормализует 31.02 в 03.03 — такие даты считаем несуществующими.
+func archivePeriodStart(year, month, day int) (time.Time, bool) {
+	start := midnight(year, time.Month(month), day)
+	if year < 1 || start.Year() != year || int(start.Month()) != month || start.Day() != day {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// archiveIndexHandler — GET /archive: перенаправляет на текущий месяц
+func archiveIndexHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, archiveMonthURL(siteNow()), http.StatusFound)
+}
+
+// archiveHandler — GET /archive/{yyyy}, /archive/{yyyy}/{mm} и /archive/{yyyy}/{mm}/{dd}.
+// Границы периода считаются в часовом поясе сайта.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	year, _ := strconv.Atoi(vars["yyyy"])
+	month, day := 1, 1
+	if v, ok := vars["mm"]; ok {
+		month, _ = strconv.Atoi(v)
+	}
+	if v, ok := vars["dd"]; ok {
+		day, _ = strconv.Atoi(v)
+	}
+
+	start, ok := archivePeriodStart(year, month, day)
+	if !ok {
+		writeError(w, r, views.NotFound("Страница не найдена"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	data := ArchiveData{
+		YearURL:         fmt.Sprintf("/archive/%04d", year),
+		IsAuthenticated: login.IsAuthenticated(r),
+		IsEditor:        login.IsEditor(r),
+	}
+
+	switch {
+	case vars["dd"] != "":
+		data.Title = fmt.Sprintf("Новости за %d %s %d", day, monthNamesGen[month-1], year)
+		data.Posts, err = loadPostsBetween(db, start, nextDay(start))
+		if err == nil {
+			data.Calendar, err = loadCalendar(db, start, day)
+		}
+	case vars["mm"] != "":
+		data.Title = fmt.Sprintf("Новости за %s %d", monthNames[month-1], year)
+		data.Posts, err = loadPostsBetween(db, start, midnight(year, time.Month(month)+1, 1))
+		if err == nil {
+			data.Calendar, err = loadCalendar(db, start, 0)
+		}
+	default:
+		data.Title = fmt.Sprintf("Новости за %d год", year)
+		var times []time.Time
+		times, err = loadPostTimes(db, start, midnight(year+1, time.January, 1))
+		counts := make([]int, 12)
+		for _, t := range times {
+			counts[t.Month()-1]++
+		}
+		for m := range counts {
+			data.Months = append(data.Months, ArchiveMonth{
+				Title: monthNames[m],
+				URL:   archiveMonthURL(midnight(year, time.Month(m+1), 1)),
+				Count: counts[m],
+			})
+		}
+	}
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения архива", err))
+		return
+	}
+	data.Meta = pageMeta(r, data.Title, "Архив статей")
+
+	render(w, r, http.StatusOK, "archive", data)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"site/views"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// embeddedFiles — шаблоны и CSS, вшитые в бинарник: сервер не зависит от рабочего каталога
+//
+//go:embed html css
+var embeddedFiles embed.FS
+
+// themeDir — каталог темы с той же раскладкой (html/, css/); его файлы подменяют встроенные
+var themeDir = flag.String("theme", "", "каталог с html/ и css/, файлы которого подменяют встроенные")
+
+// devMode — режим разработки (SITE_DEV=1): файлы читаются с диска и перечитываются при изменении
+func devMode() bool {
+	return os.Getenv("SITE_DEV") != ""
+}
+
+// siteFiles — файлы сайта: встроенные (в режиме разработки — из рабочего каталога),
+// поверх них — каталог темы
+var siteFiles = sync.OnceValue(func() fs.FS {
+	var base fs.FS = embeddedFiles
+	if devMode() {
+		base = os.DirFS(".")
+	}
+	if *themeDir != "" {
+		return overlayFS{upper: os.DirFS(*themeDir), lower: base}
+	}
+	return base
+})
+
+// overlayFS — файлы из upper, а если их там нет — из lower; каталоги объединяются
+type overlayFS struct {
+	upper, lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err != nil {
+		return o.lower.Open(name)
+	}
+	if st, err := f.Stat(); err == nil && !st.IsDir() {
+		return f, nil
+	}
+	// Каталог отдаём из lower, если он там есть: содержимое всё равно читается через ReadDir
+	if lf, err := o.lower.Open(name); err == nil {
+		f.Close()
+		return lf, nil
+	}
+	return f, nil
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, uerr := fs.ReadDir(o.upper, name)
+	lower, lerr := fs.ReadDir(o.lower, name)
+	if uerr != nil && lerr != nil {
+		return nil, lerr
+	}
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	for _, e := range upper {
+		seen[e.Name()] = true
+		entries = append(entries, e)
+	}
+	for _, e := range lower {
+		if !seen[e.Name()] {
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// staticAssets — статические файлы из css/ с отпечатком содержимого в имени
+// (css/main.css → css/main.1a2b3c4d5e.css). Такой адрес меняется вместе с файлом,
+// поэтому его можно кэшировать навсегда.
+type staticAssets struct {
+	fsys fs.FS
+	// fingerprinted: исходное имя → имя с отпечатком; original — обратно
+	fingerprinted map[string]string
+	original      map[string]string
+	etags         map[string]string
+}
+
+func newStaticAssets(fsys fs.FS) (*staticAssets, error) {
+	a := &staticAssets{
+		fsys:          fsys,
+		fingerprinted: make(map[string]string),
+		original:      make(map[string]string),
+		etags:         make(map[string]string),
+	}
+	err := fs.WalkDir(fsys, "css", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		ext := path.Ext(name)
+		fp := strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:5]) + ext
+		a.fingerprinted[name] = fp
+		a.original[fp] = name
+		a.etags[name] = `"` + hex.EncodeToString(sum[:16]) + `"`
+		return nil
+	})
+	return a, err
+}
+
+// URL — адрес файла name (например "css/main.css") для шаблонов. В режиме разработки
+// отпечаток не ставится, чтобы правки подхватывались без перезапуска.
+func (a *staticAssets) URL(name string) string {
+	if fp, ok := a.fingerprinted[name]; ok && !devMode() {
+		return "/" + fp
+	}
+	return "/" + name
+}
+
+// ServeHTTP отдаёт /css/...: по адресу с отпечатком — с вечным кэшем,
+// по обычному — с перепроверкой при каждом запросе
+func (a *staticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	cache := "no-cache"
+	if orig, ok := a.original[name]; ok && !devMode() {
+		name = orig
+		cache = "public, max-age=31536000, immutable"
+	}
+
+	st, err := fs.Stat(a.fsys, name)
+	if err != nil || st.IsDir() {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Error("static file failed", "request_id", views.RequestID(r.Context()), "name", name, "err", err)
+		}
+		writeError(w, r, views.NotFound("Файл не найден"))
+		return
+	}
+	w.Header().Set("Cache-Control", cache)
+	// У встроенных файлов нет времени изменения, поэтому перепроверка идёт по ETag
+	if etag, ok := a.etags[name]; ok && !devMode() {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeFileFS(w, r, a.fsys, name)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOverlayFS(t *testing.T) {
+	o := overlayFS{
+		upper: fstest.MapFS{
+			"html/main.html":  {Data: []byte("upper main")},
+			"html/extra.html": {Data: []byte("upper extra")},
+		},
+		lower: fstest.MapFS{
+			"html/main.html": {Data: []byte("lower main")},
+			"html/reg.html":  {Data: []byte("lower reg")},
+			"css/main.css":   {Data: []byte("lower css")},
+		},
+	}
+
+	tests := []struct {
+		name string
+		want string // пусто — файла быть не должно
+	}{
+		{"html/main.html", "upper main"},
+		{"html/extra.html", "upper extra"},
+		{"html/reg.html", "lower reg"},
+		{"css/main.css", "lower css"},
+		{"html/missing.html", ""},
+	}
+	for _, tt := range tests {
+		data, err := fs.ReadFile(o, tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("ReadFile(%q) = %q, want error", tt.name, data)
+			}
+			continue
+		}
+		if err != nil || string(data) != tt.want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", tt.name, data, err, tt.want)
+		}
+	}
+
+	dirs := []struct {
+		name string
+		want []string
+	}{
+		{"html", []string{"extra.html", "main.html", "reg.html"}},
+		{"css", []string{"main.css"}},
+	}
+	for _, tt := range dirs {
+		entries, err := fs.ReadDir(o, tt.name)
+		if err != nil {
+			t.Fatalf("ReadDir(%q): %v", tt.name, err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadDir(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if _, err := fs.ReadDir(o, "js"); err == nil {
+		t.Error("ReadDir of a missing directory succeeded")
+	}
+
+	// Шаблоны ищутся через Glob: он должен видеть файлы обоих слоёв
+	matches, err := fs.Glob(o, "html/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"html/extra.html", "html/main.html", "html/reg.html"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("Glob = %v, want %v", matches, want)
+	}
+}
+
+func TestStaticAssets(t *testing.T) {
+	css := []byte("body { color: red; }")
+	sum := sha256.Sum256(css)
+	fingerprinted := "css/main." + hex.EncodeToString(sum[:5]) + ".css"
+
+	a, err := newStaticAssets(fstest.MapFS{"css/main.css": {Data: css}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := a.URL("css/main.css"); got != "/"+fingerprinted {
+		t.Errorf("URL = %q, want %q", got, "/"+fingerprinted)
+	}
+	if got := a.URL("css/other.css"); got != "/css/other.css" {
+		t.Errorf("URL of unknown file = %q, want it unchanged", got)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		cache  string
+		etag   bool
+	}{
+		{"/" + fingerprinted, http.StatusOK, "public, max-age=31536000, immutable", true},
+		{"/css/main.css", http.StatusOK, "no-cache", true},
+		{"/css/main.0000000000.css", http.StatusNotFound, "", false},
+		{"/css", http.StatusNotFound, "", false},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		a.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.path, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got := rec.Header().Get("Cache-Control"); got != tt.cache {
+			t.Errorf("%s: Cache-Control %q, want %q", tt.path, got, tt.cache)
+		}
+		if got := rec.Header().Get("ETag") != ""; got != tt.etag {
+			t.Errorf("%s: ETag set = %v, want %v", tt.path, got, tt.etag)
+		}
+		if rec.Body.String() != string(css) {
+			t.Errorf("%s: body %q", tt.path, rec.Body)
+		}
+	}
+
+	// Тот же ETag подтверждает, что файл не менялся
+	req := httptest.NewRequest("GET", "/css/main.css", nil)
+	req.Header.Set("If-None-Match", `"`+hex.EncodeToString(sum[:16])+`"`)
+	rec := httptest.NewRecorder()
+	a.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("conditional request: status %d, want 304", rec.Code)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"site/blobstore"
+	"time"
+)
+
+// blobStore возвращает бэкенд хранения по имени из files.storage
+func blobStore(db *DB, name string) (blobstore.Store, error) {
+	switch name {
+	case "postgres":
+		return &blobstore.Postgres{DB: db.DB}, nil
+	case "disk":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return &blobstore.Disk{Dir: dir}, nil
+	case "s3":
+		region := os.Getenv("S3_REGION")
+		if region == "" {
+			region = "us-east-1"
+		}
+		s := &blobstore.S3{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			Region:    region,
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			Client:    &http.Client{Timeout: 60 * time.Second},
+		}
+		if s.Endpoint == "" || s.Bucket == "" {
+			return nil, fmt.Errorf("s3 storage requires S3_ENDPOINT and S3_BUCKET")
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown blob storage %q", name)
+}
+
+// defaultBlobStore — бэкенд для новых загрузок (BLOB_STORE: postgres, disk или s3; по умолчанию postgres)
+func defaultBlobStore(db *DB) (blobstore.Store, error) {
+	name := os.Getenv("BLOB_STORE")
+	if name == "" {
+		name = "postgres"
+	}
+	return blobStore(db, name)
+}
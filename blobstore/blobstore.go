@@ -0,0 +1,52 @@
+// Package blobstore хранит содержимое загруженных файлов. Ключ блоба — SHA-256
+// содержимого в hex, поэтому одинаковые файлы занимают место один раз.
+package blobstore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound — блоба с таким ключом нет в хранилище
+var ErrNotFound = errors.New("blobstore: blob not found")
+
+// Store — бэкенд хранения блобов
+type Store interface {
+	// Name — имя бэкенда, которое записывается в files.storage
+	Name() string
+	// Put сохраняет data под ключом key; повторный Put того же ключа не ошибка
+	// и обновляет время записи блоба (см. Sweeper)
+	Put(ctx context.Context, key string, data []byte) error
+	// Get открывает блоб на чтение с произвольным доступом (для Range-запросов);
+	// вызывающий должен закрыть результат
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete удаляет блоб; отсутствие блоба не ошибка
+	Delete(ctx context.Context, key string) error
+}
+
+// Sweeper — бэкенд, который умеет перебрать свои блобы для сборки мусора
+// (S3 его не реализует: там лишнее чистят правилами жизненного цикла бакета)
+type Sweeper interface {
+	// Sweep удаляет блобы, записанные раньше olderThan, для которых inUse вернул false.
+	// Возвращает число удалённых блобов.
+	Sweep(ctx context.Context, olderThan time.Time, inUse func(key string) (bool, error)) (int, error)
+}
+
+// Key вычисляет ключ блоба по содержимому
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// objectPath раскладывает ключи по подкаталогам из первых двух символов, чтобы не держать
+// сотни тысяч файлов в одном каталоге: "abcdef..." → "ab/abcdef..."
+func objectPath(key string) string {
+	if len(key) < 2 {
+		return key
+	}
+	return key[:2] + "/" + key
+}
@@ -0,0 +1,100 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Disk хранит блобы в локальном каталоге Dir, адресуя их по содержимому
+type Disk struct {
+	Dir string
+}
+
+func (s *Disk) Name() string { return "disk" }
+
+func (s *Disk) path(key string) string {
+	return filepath.Join(s.Dir, filepath.FromSlash(objectPath(key)))
+}
+
+func (s *Disk) Put(ctx context.Context, key string, data []byte) error {
+	dst := s.path(key)
+	if _, err := os.Stat(dst); err == nil {
+		// Содержимое определяется ключом — файл уже на месте, только освежаем время записи
+		now := time.Now()
+		return os.Chtimes(dst, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы читатели не увидели половину блоба
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+func (s *Disk) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	f, err := os.Open(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *Disk) Sweep(ctx context.Context, olderThan time.Time, inUse func(key string) (bool, error)) (int, error) {
+	deleted := 0
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.ModTime().Before(olderThan) {
+			return err
+		}
+		// Брошенные временные файлы прерванных загрузок удаляем без проверки
+		if !strings.HasPrefix(d.Name(), ".upload-") {
+			used, err := inUse(d.Name())
+			if err != nil || used {
+				return err
+			}
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		deleted++
+		return nil
+	})
+	return deleted, err
+}
+
+func (s *Disk) Delete(ctx context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
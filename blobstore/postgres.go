@@ -0,0 +1,87 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"time"
+)
+
+// Postgres хранит блобы в таблице blobs (bytea) — то же, что раньше делала files.data
+type Postgres struct {
+	DB *sql.DB
+}
+
+func (s *Postgres) Name() string { return "postgres" }
+
+func (s *Postgres) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.DB.ExecContext(ctx,
+		"INSERT INTO blobs (key, data) VALUES ($1, $2) ON CONFLICT (key) DO UPDATE SET created_at = now()",
+		key, data,
+	)
+	return err
+}
+
+func (s *Postgres) Get(ctx context.Context, key string) (io.ReadSeekCloser, error) {
+	var data []byte
+	err := s.DB.QueryRowContext(ctx, "SELECT data FROM blobs WHERE key = $1", key).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+// nopCloser делает *bytes.Reader io.ReadSeekCloser
+type nopCloser struct {
+	*bytes.Reader
+}
+
+func (nopCloser) Close() error { return nil }
+
+func (s *Postgres) Sweep(ctx context.Context, olderThan time.Time, inUse func(key string) (bool, error)) (int, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT key FROM blobs WHERE created_at < $1", olderThan.UTC())
+	if err != nil {
+		return 0, err
+	}
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		keys = append(keys, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, key := range keys {
+		used, err := inUse(key)
+		if err != nil {
+			return deleted, err
+		}
+		if used {
+			continue
+		}
+		// Повторная проверка времени: блоб могли переиспользовать, пока мы перебирали список
+		res, err := s.DB.ExecContext(ctx, "DELETE FROM blobs WHERE key = $1 AND created_at < $2", key, olderThan.UTC())
+		if err != nil {
+			return deleted, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *Postgres) Delete(ctx context.Context, key string) error {
+	_, err := s.DB.ExecContext(ctx, "DELETE FROM blobs WHERE key = $1", key)
+	return err
+}
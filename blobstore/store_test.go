@@ -0,0 +1,144 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testStore проверяет общий контракт Store: Put/Get/Delete, повторный Put,
+// чтение с произвольной позиции и ErrNotFound для отсутствующих ключей
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	data := []byte("содержимое блоба для проверки хранилища")
+	key := Key(data)
+
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get before Put: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Put(ctx, key, data); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := s.Put(ctx, key, data); err != nil {
+		t.Fatalf("repeated Put: %v", err)
+	}
+
+	blob, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get = %q, want %q", got, data)
+	}
+
+	// http.ServeContent читает хвост после Seek — так отдаются Range-запросы
+	if _, err := blob.Seek(-5, io.SeekEnd); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	tail, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatalf("read after Seek: %v", err)
+	}
+	if !bytes.Equal(tail, data[len(data)-5:]) {
+		t.Errorf("tail = %q, want %q", tail, data[len(data)-5:])
+	}
+	if err := blob.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of missing blob: %v", err)
+	}
+}
+
+func TestDisk(t *testing.T) {
+	testStore(t, &Disk{Dir: t.TempDir()})
+}
+
+func TestS3(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	testStore(t, &S3{Endpoint: srv.URL, Bucket: "media", Region: "us-east-1", AccessKey: "AK", SecretKey: "SK", Client: srv.Client()})
+
+	if fake.unsigned > 0 {
+		t.Errorf("%d requests without a SigV4 signature", fake.unsigned)
+	}
+}
+
+// fakeS3 — минимальный S3 в памяти: PUT, HEAD, GET с Range и DELETE по пути /bucket/ключ
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string][]byte
+	unsigned int
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") ||
+		r.Header.Get("x-amz-date") == "" || r.Header.Get("x-amz-content-sha256") == "" {
+		f.unsigned++
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+		return
+	}
+
+	obj, ok := f.objects[r.URL.Path]
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get("x-amz-content-sha256") != sha256Hex(body) {
+			http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = body
+	case http.MethodHead, http.MethodGet:
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(obj)))
+			return
+		}
+		if rng, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes="); ok {
+			start, err := strconv.Atoi(strings.TrimSuffix(rng, "-"))
+			if err != nil || start >= len(obj) {
+				http.Error(w, "InvalidRange", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(obj[start:])
+			return
+		}
+		w.Write(obj)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"site/blobstore"
+)
+
+// runCommand выполняет подкоманду `site <команда> [флаги]`
+func runCommand(db *DB, args []string) error {
+	switch args[0] {
+	case "migrate-files":
+		return migrateFilesCommand(db, args[1:])
+	case "gc-files":
+		return gcFilesCommand(db, args[1:])
+	}
+	return fmt.Errorf("unknown command %q (available: migrate-files, gc-files)", args[0])
+}
+
+// gcFilesCommand — `site gc-files [-grace 1h]`: разовый запуск сборщика файлов без ссылок
+func gcFilesCommand(db *DB, args []string) error {
+	fs := flag.NewFlagSet("gc-files", flag.ContinueOnError)
+	grace := fs.Duration("grace", fileGCGrace, "не удалять файлы моложе этого срока")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	files, blobs, err := collectGarbageFiles(context.Background(), db, *grace)
+	log.Printf("gc-files: removed %d files, %d blobs\n", files, blobs)
+	return err
+}
+
+// migrateFilesCommand — `site migrate-files -from postgres -to disk`: переносит содержимое
+// files и file_renditions между бэкендами хранения. Строки, созданные до появления blobstore
+// (данные в колонке data), считаются лежащими в postgres.
+func migrateFilesCommand(db *DB, args []string) error {
+	fs := flag.NewFlagSet("migrate-files", flag.ContinueOnError)
+	from := fs.String("from", "postgres", "исходный бэкенд: postgres, disk или s3")
+	to := fs.String("to", "", "целевой бэкенд: postgres, disk или s3")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *to == "" {
+		return fmt.Errorf("migrate-files: -to is required")
+	}
+	if *to == *from {
+		return fmt.Errorf("migrate-files: -from and -to are both %q", *to)
+	}
+
+	src, err := blobStore(db, *from)
+	if err != nil {
+		return err
+	}
+	dst, err := blobStore(db, *to)
+	if err != nil {
+		return err
+	}
+
+	// Сначала собираем список, чтобы не держать курсор открытым во время переноса
+	rows, err := db.Query(
+		`SELECT 'files', id, '', blob_key FROM files WHERE storage = $1
+         UNION ALL
+         SELECT 'file_renditions', file_id, size, blob_key FROM file_renditions WHERE storage = $1`,
+		*from,
+	)
+	if err != nil {
+		return err
+	}
+	type blobRow struct {
+		table  string
+		fileID int
+		size   string
+		key    sql.NullString
+	}
+	var todo []blobRow
+	for rows.Next() {
+		var br blobRow
+		if err := rows.Scan(&br.table, &br.fileID, &br.size, &br.key); err != nil {
+			rows.Close()
+			return err
+		}
+		todo = append(todo, br)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	moved := 0
+	for _, br := range todo {
+		where, args := "id = $1", []any{br.fileID}
+		if br.table == "file_renditions" {
+			where, args = "file_id = $1 AND size = $2", []any{br.fileID, br.size}
+		}
+
+		var data []byte
+		if br.key.Valid {
+			blob, err := src.Get(ctx, br.key.String)
+			if err != nil {
+				return fmt.Errorf("%s %d %s: %w", br.table, br.fileID, br.size, err)
+			}
+			data, err = io.ReadAll(blob)
+			blob.Close()
+			if err != nil {
+				return err
+			}
+		} else {
+			err := db.QueryRow("SELECT data FROM "+br.table+" WHERE "+where, args...).Scan(&data)
+			if err != nil {
+				return fmt.Errorf("%s %d %s: %w", br.table, br.fileID, br.size, err)
+			}
+		}
+
+		key := blobstore.Key(data)
+		if err := dst.Put(ctx, key, data); err != nil {
+			return err
+		}
+		n := len(args)
+		_, err := db.Exec(
+			fmt.Sprintf("UPDATE %s SET blob_key = $%d, storage = $%d, data = NULL WHERE %s", br.table, n+1, n+2, where),
+			append(args, key, dst.Name())...,
+		)
+		if err != nil {
+			return err
+		}
+
+		// Удаляем исходный блоб, только если на него больше никто не ссылается
+		if br.key.Valid {
+			used, err := blobInUse(ctx, db, br.key.String, src.Name())
+			if err != nil {
+				return err
+			}
+			if !used {
+				if err := src.Delete(ctx, br.key.String); err != nil {
+					return err
+				}
+			}
+		}
+		moved++
+	}
+
+	log.Printf("migrate-files: moved %d blobs from %s to %s\n", moved, *from, *to)
+	return nil
+}
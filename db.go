@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"site/views"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// slowQuery — запросы к БД дольше этого пишутся в журнал с уровнем Warn, остальные — Debug
+const slowQuery = 500 * time.Millisecond
+
+// dbDSN — строка подключения к PostgreSQL, только из DATABASE_URL: адрес и пароль базы
+// в код не зашиваются. Без неё сервер и команды не запускаются.
+func dbDSN() (string, error) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		return "", errors.New("DATABASE_URL не задан")
+	}
+	return dsn, nil
+}
+
+// dbPool — общий пул соединений на весь процесс. Размер задаётся DB_MAX_OPEN_CONNS
+// и DB_MAX_IDLE_CONNS (по умолчанию 20 и 10).
+var dbPool = sync.OnceValues(func() (*sql.DB, error) {
+	dsn, err := dbDSN()
+	if err != nil {
+		return nil, err
+	}
+	c, err := pq.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	pool := sql.OpenDB(loggedConnector{Connector: c})
+	pool.SetMaxOpenConns(envInt("DB_MAX_OPEN_CONNS", 20))
+	pool.SetMaxIdleConns(envInt("DB_MAX_IDLE_CONNS", 10))
+	pool.SetConnMaxIdleTime(5 * time.Minute)
+	return pool, nil
+})
+
+func envInt(name string, def int) int {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+		slog.Warn("invalid integer setting, using default", "name", name, "value", v, "default", def)
+	}
+	return def
+}
+
+// DB — общий пул, привязанный к контексту: Query, QueryRow, Exec и Begin выполняются
+// с этим контекстом. Для обработчиков это контекст запроса — запросы к БД отменяются
+// вместе с ним и попадают в журнал с его номером.
+type DB struct {
+	*sql.DB
+	ctx context.Context
+}
+
+func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.DB.QueryContext(d.ctx, query, args...)
+}
+
+func (d *DB) QueryRow(query string, args ...any) *sql.Row {
+	return d.DB.QueryRowContext(d.ctx, query, args...)
+}
+
+func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return d.DB.ExecContext(d.ctx, query, args...)
+}
+
+func (d *DB) Begin() (*sql.Tx, error) {
+	return d.DB.BeginTx(d.ctx, nil)
+}
+
+// Close ничего не делает: пул общий и закрывается один раз при остановке сервера.
+// Оставлен, чтобы обработчики по-прежнему писали defer db.Close().
+func (d *DB) Close() error {
+	return nil
+}
+
+// connectToDB — БД для команд; обработчики запросов используют requestDB, фоновые задачи — contextDB
+func connectToDB() (*DB, error) {
+	return contextDB(context.Background())
+}
+
+// contextDB — БД, запросы к которой отменяются вместе с ctx (например, при остановке сервера)
+func contextDB(ctx context.Context) (*DB, error) {
+	pool, err := dbPool()
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: pool, ctx: ctx}, nil
+}
+
+// requestDB — БД для обработчика запроса r: запросы к БД в журнале помечены
+// тем же номером, что и сам запрос и страница ошибки
+func requestDB(r *http.Request) (*DB, error) {
+	pool, err := dbPool()
+	if err != nil {
+		return nil, err
+	}
+	return &DB{DB: pool, ctx: r.Context()}, nil
+}
+
+// closeDBPool закрывает общий пул; вызывается один раз, когда запросы и фоновые задачи завершены
+func closeDBPool() {
+	if pool, err := dbPool(); err == nil {
+		if err := pool.Close(); err != nil {
+			slog.Error("closing db pool failed", "err", err)
+		}
+	}
+}
+
+type loggedConnector struct {
+	driver.Connector
+}
+
+func (c loggedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Колонки TIMESTAMP хранят UTC: now() в запросах (deleted_at = now() и т.п.)
+	// должен давать UTC, какой бы пояс ни был настроен на сервере БД
+	if _, err := conn.(driver.ExecerContext).ExecContext(ctx, "SET TIME ZONE 'UTC'", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &loggedConn{Conn: conn, requestID: views.RequestID(ctx)}, nil
+}
+
+// loggedConn — соединение pq, которое пишет в журнал каждый запрос и его длительность.
+// requestID — номер запроса, взявшего соединение из пула: запросы внутри транзакции
+// идут без контекста, и номер берётся отсюда.
+type loggedConn struct {
+	driver.Conn
+	requestID string
+}
+
+func (c *loggedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+	c.log(ctx, query, start, err)
+	return rows, err
+}
+
+func (c *loggedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	c.log(ctx, query, start, err)
+	return res, err
+}
+
+func (c *loggedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+}
+
+func (c *loggedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.requestID = views.RequestID(ctx)
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *loggedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+// ResetSession вызывается, когда соединение снова берут из пула, — с контекстом нового владельца
+func (c *loggedConn) ResetSession(ctx context.Context) error {
+	c.requestID = views.RequestID(ctx)
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *loggedConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+func (c *loggedConn) log(ctx context.Context, query string, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		return
+	}
+	elapsed := time.Since(start)
+	dbQueryDuration.Observe(elapsed.Seconds())
+	level := slog.LevelDebug
+	if elapsed >= slowQuery {
+		level = slog.LevelWarn
+	}
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+	id := views.RequestID(ctx)
+	if id == "" {
+		id = c.requestID
+	}
+	var attrs []slog.Attr
+	if id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	attrs = append(attrs,
+		slog.String("query", strings.Join(strings.Fields(query), " ")),
+		slog.Float64("duration_ms", msSince(start)),
+	)
+	if err != nil {
+		attrs = append(attrs, slog.String("err", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, "db query", attrs...)
+}
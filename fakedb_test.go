@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"site/internal/sqlfake"
+	"site/login"
+	"testing"
+	"time"
+)
+
+// fakeDB и fakeResult — поддельная БД из sqlfake, общая для тестов обработчиков
+type (
+	fakeDB     = sqlfake.DB
+	fakeResult = sqlfake.Result
+)
+
+// useFakeDB подменяет общий пул на sqlfake.DB с ответами respond до конца теста
+func useFakeDB(t *testing.T, respond func(query string, args []driver.Value) fakeResult) *fakeDB {
+	f := sqlfake.New(respond)
+	pool := f.Open()
+	saved := dbPool
+	dbPool = func() (*sql.DB, error) { return pool, nil }
+	t.Cleanup(func() {
+		dbPool = saved
+		pool.Close()
+	})
+	return f
+}
+
+// sessionCookie — кука входа пользователя email с ролью role; checkedAt — время последней
+// сверки с users (нулевое — ещё не сверялась)
+func sessionCookie(t *testing.T, email, role string, checkedAt time.Time) *http.Cookie {
+	t.Helper()
+	r := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	session, _ := login.Store.Get(r, "session-name")
+	session.Values["authenticated"] = true
+	session.Values["user_email"] = email
+	session.Values["role"] = role
+	if !checkedAt.IsZero() {
+		session.Values["checked_at"] = checkedAt.Unix()
+	}
+	if err := session.Save(r, rec); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Result().Cookies()[0]
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"site/views"
+	"strings"
+	"time"
+)
+
+// feedSize — сколько последних статей попадает в ленту
+const feedSize = 20
+
+// feedTitle — название сайта в лентах
+const feedTitle = "Новости"
+
+// feedEpoch — время обновления пустой ленты: Atom требует <updated>, а постоянное значение,
+// в отличие от текущего времени, не меняет ETag пустой ленты на каждом запросе
+var feedEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FeedItem — статья для ленты вместе с обложкой и временем последней правки
+type FeedItem struct {
+	Post
+	UpdatedAt    time.Time
+	PhotoMime    string
+	PhotoSize    int64
+	PhotoVersion string
+}
+
+// siteURL — адрес сайта без завершающего "/" из SITE_URL. Host и X-Forwarded-* присылает
+// клиент, и подставлять их в ссылки лент, карты сайта и canonical нельзя, поэтому без SITE_URL
+// сервер не запускается (см. checkSiteURL); адрес запроса берётся только в режиме разработки.
+func siteURL(r *http.Request) string {
+	if v := os.Getenv("SITE_URL"); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// checkSiteURL проверяет SITE_URL при запуске: обязателен вне режима разработки,
+// должен быть абсолютным адресом http(s) без пути запроса
+func checkSiteURL() error {
+	v := os.Getenv("SITE_URL")
+	if v == "" {
+		if devMode() {
+			return nil
+		}
+		return errors.New("SITE_URL is not set (e.g. https://example.com)")
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return fmt.Errorf("SITE_URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("SITE_URL must be an absolute http(s) URL, got %q", v)
+	}
+	return nil
+}
+
+// loadFeedItems возвращает последние опубликованные статьи, при непустом tag — только с этим тегом
+func loadFeedItems(db *DB, tag string) ([]FeedItem, error) {
+	rows, err := db.Query(
+		`SELECT p.id, p.title, p.anons, p.full_text, p.full_text_html, p.photo_id, p.created_at,
+                `+postUpdatedAtSQL+`,
+                COALESCE(f.mime_type, ''), COALESCE(f.size, 0), COALESCE(LEFT(f.blob_key, 16), '')
+           FROM post p LEFT JOIN files f ON f.id = p.photo_id
+          WHERE p.deleted_at IS NULL AND p.unpublished_at IS NULL
+            AND ($1 = '' OR EXISTS (SELECT 1 FROM post_tags t WHERE t.post_id = p.id AND t.tag = $1))
+          ORDER BY p.created_at DESC, p.id DESC
+          LIMIT $2`,
+		tag, feedSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var items []FeedItem
+	for rows.Next() {
+		var it FeedItem
+		err := rows.Scan(&it.Id, &it.Title, &it.Anons, &it.Full_text, (*string)(&it.FullTextHTML), &it.PhotoID, &it.CreatedAt,
+			&it.UpdatedAt, &it.PhotoMime, &it.PhotoSize, &it.PhotoVersion)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Теги и отложенный рендеринг Markdown — после закрытия курсора
+	for i := range items {
+		if items[i].Tags, err = loadPostTags(db, items[i].Id); err != nil {
+			return nil, err
+		}
+		if err := ensureRenderedHTML(db, &items[i].Post); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// photoURL — абсолютный адрес обложки статьи
+func (it FeedItem) photoURL(base string) string {
+	return base + Media{FileID: int(it.PhotoID.Int64), Version: it.PhotoVersion}.URL("full")
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	AtomNS    string     `xml:"xmlns:atom,attr"`
+	ContentNS string     `xml:"xmlns:content,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	Self          rssAtomLink `xml:"atom:link"`
+	Language      string      `xml:"language"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate"`
+	Description string        `xml:"description"`
+	Content     rssCDATA      `xml:"content:encoded"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssCDATA struct {
+	Value string `xml:",cdata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Links      []atomLink     `xml:"link"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Summary    string         `xml:"summary"`
+	Content    atomContent    `xml:"content"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomContent struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// buildRSS собирает RSS 2.0: анонс — в description, полный текст — в content:encoded, обложка — enclosure
+func buildRSS(items []FeedItem, base, self, tag string, updated time.Time) any {
+	ch := rssChannel{
+		Title:       feedTitle,
+		Link:        base + "/",
+		Description: "Последние статьи",
+		Self:        rssAtomLink{Href: self, Rel: "self", Type: "application/rss+xml"},
+		Language:    "ru",
+	}
+	if tag != "" {
+		ch.Title += " — " + tag
+		ch.Description = "Последние статьи с тегом «" + tag + "»"
+	}
+	if !updated.IsZero() {
+		ch.LastBuildDate = updated.UTC().Format(time.RFC1123Z)
+	}
+	for _, it := range items {
+		link := fmt.Sprintf("%s/post/%d", base, it.Id)
+		item := rssItem{
+			Title:       it.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     it.CreatedAt.UTC().Format(time.RFC1123Z),
+			Description: it.Anons,
+			Content:     rssCDATA{Value: string(it.FullTextHTML)},
+			Categories:  it.Tags,
+		}
+		if it.PhotoID.Valid {
+			item.Enclosure = &rssEnclosure{URL: it.photoURL(base), Length: it.PhotoSize, Type: it.PhotoMime}
+		}
+		ch.Items = append(ch.Items, item)
+	}
+	return rssFeed{Version: "2.0", AtomNS: "http://www.w3.org/2005/Atom", ContentNS: "http://purl.org/rss/1.0/modules/content/", Channel: ch}
+}
+
+// buildAtom собирает Atom 1.0 с теми же данными, что buildRSS
+func buildAtom(items []FeedItem, base, self, tag string, updated time.Time) any {
+	if updated.IsZero() {
+		updated = feedEpoch
+	}
+	feed := atomFeed{
+		Title:   feedTitle,
+		ID:      self,
+		Updated: updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: feedTitle},
+		Links: []atomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: base + "/", Rel: "alternate", Type: "text/html"},
+		},
+	}
+	if tag != "" {
+		feed.Title += " — " + tag
+	}
+	for _, it := range items {
+		link := fmt.Sprintf("%s/post/%d", base, it.Id)
+		e := atomEntry{
+			Title:     it.Title,
+			ID:        link,
+			Links:     []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+			Published: it.CreatedAt.UTC().Format(time.RFC3339),
+			Updated:   it.UpdatedAt.UTC().Format(time.RFC3339),
+			Summary:   it.Anons,
+			Content:   atomContent{Type: "html", Value: string(it.FullTextHTML)},
+		}
+		for _, t := range it.Tags {
+			e.Categories = append(e.Categories, atomCategory{Term: t})
+		}
+		if it.PhotoID.Valid {
+			e.Links = append(e.Links, atomLink{Href: it.photoURL(base), Rel: "enclosure", Type: it.PhotoMime, Length: it.PhotoSize})
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	return feed
+}
+
+// feedHandler — GET /feed.rss и /feed.atom (?tag= — лента по тегу). Ответ отдаётся через
+// http.ServeContent с ETag по содержимому и Last-Modified по последней правке, поэтому
+// читалки, присылающие If-None-Match или If-Modified-Since, получают 304 без тела.
+func feedHandler(contentType string, build func(items []FeedItem, base, self, tag string, updated time.Time) any) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag")))
+
+		db, err := requestDB(r)
+		if err != nil {
+			writeError(w, r, views.Internal("Error connecting to the database", err))
+			return
+		}
+		defer db.Close()
+
+		items, err := loadFeedItems(db, tag)
+		if err != nil {
+			writeError(w, r, views.Internal("Error querying the database", err))
+			return
+		}
+
+		var updated time.Time
+		for _, it := range items {
+			if it.UpdatedAt.After(updated) {
+				updated = it.UpdatedAt
+			}
+		}
+
+		base := siteURL(r)
+		self := base + r.URL.Path
+		if tag != "" {
+			self += "?tag=" + url.QueryEscape(tag)
+		}
+
+		var buf bytes.Buffer
+		buf.WriteString(xml.Header)
+		if err := xml.NewEncoder(&buf).Encode(build(items, base, self, tag, updated)); err != nil {
+			writeError(w, r, views.Internal("Error encoding feed", err))
+			return
+		}
+
+		sum := sha256.Sum256(buf.Bytes())
+		h := w.Header()
+		h.Set("Content-Type", contentType)
+		h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		h.Set("Cache-Control", "public, no-cache")
+		http.ServeContent(w, r, "", updated, bytes.NewReader(buf.Bytes()))
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/tls"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSiteURL(t *testing.T) {
+	tests := []struct {
+		url, dev string
+		ok       bool
+	}{
+		{"", "", false},
+		{"", "1", true},
+		{"https://example.com", "", true},
+		{"http://localhost:8080/", "", true},
+		{"example.com", "", false},
+		{"ftp://example.com", "", false},
+		{"https://example.com/?a=1", "", false},
+	}
+	for _, tt := range tests {
+		t.Setenv("SITE_URL", tt.url)
+		t.Setenv("SITE_DEV", tt.dev)
+		if err := checkSiteURL(); (err == nil) != tt.ok {
+			t.Errorf("SITE_URL=%q SITE_DEV=%q: err = %v, want ok=%v", tt.url, tt.dev, err, tt.ok)
+		}
+	}
+}
+
+func TestSiteURLIgnoresForwardedHeaders(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://internal:8080/feed.rss", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "evil.example")
+
+	t.Setenv("SITE_URL", "https://example.com/")
+	if got := siteURL(r); got != "https://example.com" {
+		t.Errorf("with SITE_URL: %q", got)
+	}
+
+	t.Setenv("SITE_URL", "")
+	if got := siteURL(r); got != "http://internal:8080" {
+		t.Errorf("without SITE_URL: %q", got)
+	}
+	r.TLS = &tls.ConnectionState{}
+	if got := siteURL(r); got != "https://internal:8080" {
+		t.Errorf("TLS without SITE_URL: %q", got)
+	}
+}
+
+// feedItems — две статьи: с обложкой и тегами и без них
+func feedItems() []FeedItem {
+	created := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	return []FeedItem{
+		{
+			Post: Post{Id: 2, Title: "Вторая & <последняя>", Anons: "Анонс", FullTextHTML: "<p>Текст <b>жирный</b></p>",
+				PhotoID: sql.NullInt64{Int64: 5, Valid: true}, CreatedAt: created.Add(time.Hour), Tags: []string{"go", "новости"}},
+			UpdatedAt: created.Add(2 * time.Hour), PhotoMime: "image/jpeg", PhotoSize: 1234, PhotoVersion: "abcdef0123456789",
+		},
+		{Post: Post{Id: 1, Title: "Первая", FullTextHTML: "<p>1</p>", CreatedAt: created}, UpdatedAt: created},
+	}
+}
+
+// feedLinks — все адреса из атрибутов href/url и элементов link/guid/id ленты
+func feedLinks(body string) []string {
+	var links []string
+	for _, re := range []string{`(?:href|url)="([^"]*)"`, `<(?:link|guid[^>]*|id)>([^<]*)</`} {
+		for _, m := range regexp.MustCompile(re).FindAllStringSubmatch(body, -1) {
+			links = append(links, m[1])
+		}
+	}
+	return links
+}
+
+func encodeFeed(t *testing.T, feed any) string {
+	t.Helper()
+	out, err := xml.Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestBuildFeeds(t *testing.T) {
+	const base = "https://example.com"
+	updated := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	rss := encodeFeed(t, buildRSS(feedItems(), base, base+"/feed.rss?tag=go", "go", updated))
+	atom := encodeFeed(t, buildAtom(feedItems(), base, base+"/feed.atom?tag=go", "go", updated))
+
+	for name, body := range map[string]string{"rss": rss, "atom": atom} {
+		links := feedLinks(body)
+		if len(links) < 6 {
+			t.Errorf("%s: too few links %q", name, links)
+		}
+		for _, link := range links {
+			if !strings.HasPrefix(link, base+"/") {
+				t.Errorf("%s: link %q is not absolute", name, link)
+			}
+		}
+		for _, want := range []string{
+			"https://example.com/post/2", "https://example.com/post/1",
+			"https://example.com/file/5?v=abcdef0123456789",
+			"Вторая &amp; &lt;последняя&gt;", "Новости — go",
+		} {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s lacks %q:\n%s", name, want, body)
+			}
+		}
+		// Заголовок экранирован, а не вставлен разметкой
+		if strings.Contains(body, "<последняя>") {
+			t.Errorf("%s: unescaped title in the feed:\n%s", name, body)
+		}
+	}
+
+	for _, want := range []string{
+		`<rss version="2.0"`, `<atom:link href="https://example.com/feed.rss?tag=go" rel="self" type="application/rss+xml">`,
+		`<guid isPermaLink="true">https://example.com/post/2</guid>`,
+		`<pubDate>Sat, 01 Mar 2025 11:00:00 +0000</pubDate>`,
+		`<lastBuildDate>Sat, 01 Mar 2025 12:00:00 +0000</lastBuildDate>`,
+		`<content:encoded><![CDATA[<p>Текст <b>жирный</b></p>]]></content:encoded>`,
+		`<category>go</category><category>новости</category>`,
+		`<enclosure url="https://example.com/file/5?v=abcdef0123456789" length="1234" type="image/jpeg">`,
+	} {
+		if !strings.Contains(rss, want) {
+			t.Errorf("rss lacks %s:\n%s", want, rss)
+		}
+	}
+	for _, want := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`, `<id>https://example.com/feed.atom?tag=go</id>`,
+		`<updated>2025-03-01T12:00:00Z</updated>`,
+		`<published>2025-03-01T11:00:00Z</published><updated>2025-03-01T12:00:00Z</updated>`,
+		`<content type="html">&lt;p&gt;Текст &lt;b&gt;жирный&lt;/b&gt;&lt;/p&gt;</content>`,
+		`<category term="новости">`,
+		`<link href="https://example.com/file/5?v=abcdef0123456789" rel="enclosure" type="image/jpeg" length="1234">`,
+	} {
+		if !strings.Contains(atom, want) {
+			t.Errorf("atom lacks %s:\n%s", want, atom)
+		}
+	}
+}
+
+func TestBuildAtomEmpty(t *testing.T) {
+	atom := encodeFeed(t, buildAtom(nil, "https://example.com", "https://example.com/feed.atom", "", time.Time{}))
+	if !strings.Contains(atom, "<updated>"+feedEpoch.Format(time.RFC3339)+"</updated>") {
+		t.Errorf("empty feed without a valid updated time:\n%s", atom)
+	}
+	rss := encodeFeed(t, buildRSS(nil, "https://example.com", "https://example.com/feed.rss", "", time.Time{}))
+	if strings.Contains(rss, "lastBuildDate") || strings.Contains(rss, "0001") {
+		t.Errorf("empty rss has a zero build date:\n%s", rss)
+	}
+}
+
+func TestFeedHandler(t *testing.T) {
+	t.Setenv("SITE_URL", "https://example.com")
+	items := feedItems()
+	f := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.Contains(query, "FROM post p LEFT JOIN files"):
+			var rows [][]driver.Value
+			for _, it := range items {
+				var photo any
+				if it.PhotoID.Valid {
+					photo = it.PhotoID.Int64
+				}
+				rows = append(rows, []driver.Value{int64(it.Id), it.Title, it.Anons, it.Full_text, string(it.FullTextHTML), photo,
+					it.CreatedAt, it.UpdatedAt, it.PhotoMime, it.PhotoSize, it.PhotoVersion})
+			}
+			return fakeResult{Cols: make([]string, 11), Rows: rows}
+		case strings.Contains(query, "FROM post_tags"):
+			return fakeResult{Cols: []string{"tag"}, Rows: [][]driver.Value{{"go"}}}
+		}
+		return fakeResult{Err: errors.New("unexpected query: " + query)}
+	})
+	h := feedHandler("application/atom+xml; charset=utf-8", buildAtom)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/feed.atom?tag=%20Go", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if lm := rec.Header().Get("Last-Modified"); lm != "Sat, 01 Mar 2025 12:00:00 GMT" {
+		t.Errorf("Last-Modified %q, want the latest edit", lm)
+	}
+	body := rec.Body.String()
+	if !strings.HasPrefix(body, xml.Header) || !strings.Contains(body, `<link href="https://example.com/feed.atom?tag=go" rel="self"`) {
+		t.Errorf("body:\n%s", body)
+	}
+	if args := f.Queries()[0].Args; len(args) == 0 || args[0] != "go" {
+		t.Errorf("tag passed to the query as %v, want normalized go", args)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	for name, header := range map[string][2]string{
+		"If-None-Match":     {"If-None-Match", etag},
+		"If-Modified-Since": {"If-Modified-Since", "Sat, 01 Mar 2025 12:00:00 GMT"},
+	} {
+		r := httptest.NewRequest("GET", "/feed.atom?tag=go", nil)
+		r.Header.Set(header[0], header[1])
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s: status %d, body %d bytes, want 304 without body", name, rec.Code, rec.Body.Len())
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/feed.atom?tag=go", nil)
+	r.Header.Set("If-None-Match", `"stale"`)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("stale ETag: status %d, want 200", rec.Code)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"site/blobstore"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// fileGCGrace — сколько живёт файл без ссылок: загрузка сохраняет файл раньше,
+// чем пост ссылается на него, и такие свежие файлы трогать нельзя
+const fileGCGrace = time.Hour
+
+// blobLockClass — первый ключ advisory-блокировок блобов, второй — hashtext ключа блоба
+const blobLockClass = 3301
+
+// lockBlob берёт транзакционную advisory-блокировку ключа блоба: разделяемую (shared) — загрузка
+// от Put до фиксации своих строк files, исключительную — сборщик на проверку ссылок и удаление.
+// Так сборщик видит либо блоб без ссылок до загрузки, либо уже записанные ссылки после неё.
+func lockBlob(ctx context.Context, tx *sql.Tx, key string, shared bool) error {
+	lock := "pg_advisory_xact_lock"
+	if shared {
+		lock = "pg_advisory_xact_lock_shared"
+	}
+	_, err := tx.ExecContext(ctx, "SELECT "+lock+"($1, hashtext($2))", blobLockClass, key)
+	return err
+}
+
+// blobRef — блоб в конкретном бэкенде хранения
+type blobRef struct {
+	key     string
+	storage string
+}
+
+// collectGarbageFiles удаляет файлы, на которые не ссылается ни пост, ни ревизия, ни галерея
+// (см. представление file_ref_counts), а затем блобы, оставшиеся без строк files/file_renditions.
+// Возвращает число удалённых файлов и блобов.
+func collectGarbageFiles(ctx context.Context, db *DB, grace time.Duration) (int, int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// 1) Блокируем кандидатов: FOR UPDATE не даст новым ссылкам (FK) появиться до удаления.
+	// Строку, которую storeUpload как раз переиспользует, Postgres после ожидания проверит
+	// заново — со свежим created_at она выпадет из выборки.
+	rows, err := tx.QueryContext(ctx,
+		`SELECT f.id FROM files f
+          WHERE f.id IN (SELECT file_id FROM file_ref_counts WHERE refs = 0)
+            AND f.created_at < now() - $1 * interval '1 second'
+          FOR UPDATE OF f SKIP LOCKED`,
+		grace.Seconds(),
+	)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	// 2) Запоминаем их блобы, пока строки на месте
+	var refs []blobRef
+	if len(ids) > 0 {
+		rows, err := tx.QueryContext(ctx,
+			`SELECT blob_key, storage FROM files WHERE id = ANY($1) AND blob_key IS NOT NULL
+             UNION
+             SELECT blob_key, storage FROM file_renditions WHERE file_id = ANY($1) AND blob_key IS NOT NULL`,
+			pq.Array(ids),
+		)
+		if err != nil {
+			return 0, 0, err
+		}
+		for rows.Next() {
+			var ref blobRef
+			if err := rows.Scan(&ref.key, &ref.storage); err != nil {
+				rows.Close()
+				return 0, 0, err
+			}
+			refs = append(refs, ref)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, 0, err
+		}
+
+		// Копии размеров удаляются каскадом
+		if _, err := tx.ExecContext(ctx, "DELETE FROM files WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, 0, err
+	}
+
+	// 3) Блобы удалённых файлов, если их не делят с другими файлами
+	blobs := 0
+	for _, ref := range refs {
+		deleted, err := deleteUnusedBlob(ctx, db, ref)
+		if err != nil {
+			return len(ids), blobs, err
+		}
+		if deleted {
+			blobs++
+		}
+	}
+
+	// 4) Блобы, оставшиеся от прерванных загрузок, в бэкендах, которые умеют себя перебирать
+	for _, name := range []string{"postgres", "disk"} {
+		store, err := blobStore(db, name)
+		if err != nil {
+			return len(ids), blobs, err
+		}
+		sweeper, ok := store.(blobstore.Sweeper)
+		if !ok {
+			continue
+		}
+		n, err := sweeper.Sweep(ctx, time.Now().Add(-grace), func(key string) (bool, error) {
+			return blobInUse(ctx, db, key, name)
+		})
+		blobs += n
+		if err != nil {
+			return len(ids), blobs, err
+		}
+	}
+
+	return len(ids), blobs, nil
+}
+
+// deleteUnusedBlob удаляет блоб, если на него не ссылается ни одна строка. Проверка и удаление
+// идут под исключительной блокировкой ключа (см. lockBlob): параллельная загрузка того же
+// содержимого либо дождётся удаления и запишет блоб заново, либо успеет записать ссылку.
+func deleteUnusedBlob(ctx context.Context, db *DB, ref blobRef) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if err := lockBlob(ctx, tx, ref.key, false); err != nil {
+		return false, err
+	}
+	var used bool
+	err = tx.QueryRowContext(ctx, blobInUseSQL, ref.key, ref.storage).Scan(&used)
+	if err != nil || used {
+		return false, err
+	}
+	store, err := blobStore(db, ref.storage)
+	if err != nil {
+		return false, err
+	}
+	if err := store.Delete(ctx, ref.key); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// blobInUseSQL — есть ли ссылки на блоб $1 в бэкенде $2
+const blobInUseSQL = `SELECT EXISTS (SELECT 1 FROM files WHERE blob_key = $1 AND storage = $2)
+                          OR EXISTS (SELECT 1 FROM file_renditions WHERE blob_key = $1 AND storage = $2)`
+
+// blobInUse — ссылается ли на блоб хоть одна строка files или file_renditions
+func blobInUse(ctx context.Context, db *DB, key, storage string) (bool, error) {
+	var used bool
+	err := db.QueryRowContext(ctx, blobInUseSQL, key, storage).Scan(&used)
+	return used, err
+}
+
+// runFileGC раз в час удаляет файлы без ссылок, пока не отменён ctx
+func runFileGC(ctx context.Context) {
+	for {
+		db, err := contextDB(ctx)
+		if err == nil {
+			files, blobs, gcErr := collectGarbageFiles(ctx, db, fileGCGrace)
+			err = gcErr
+			if files > 0 || blobs > 0 {
+				slog.Info("unused files removed", "job", "file-gc", "files", files, "blobs", blobs)
+			}
+			db.Close()
+		}
+		if err != nil && ctx.Err() == nil {
+			slog.Error("file gc failed", "job", "file-gc", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
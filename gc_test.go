@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeleteUnusedBlob(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		used bool
+	}{{"unused", false}, {"used", true}} {
+		used := tt.used
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("BLOB_DIR", dir)
+			f := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+				if strings.HasPrefix(query, "SELECT EXISTS") {
+					return fakeResult{Cols: []string{"used"}, Rows: [][]driver.Value{{used}}}
+				}
+				return fakeResult{}
+			})
+			db, _ := contextDB(context.Background())
+			store, _ := blobStore(db, "disk")
+			if err := store.Put(context.Background(), "abc123", []byte("blob")); err != nil {
+				t.Fatal(err)
+			}
+
+			deleted, err := deleteUnusedBlob(context.Background(), db, blobRef{key: "abc123", storage: "disk"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted == used {
+				t.Errorf("deleted = %v for a blob in use = %v", deleted, used)
+			}
+			var left []string
+			filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					left = append(left, d.Name())
+				}
+				return nil
+			})
+			if (len(left) > 0) != used {
+				t.Errorf("files left %v, want the blob kept = %v", left, used)
+			}
+
+			// Ссылки проверяются под исключительной блокировкой ключа, в той же транзакции
+			end := "COMMIT"
+			if used {
+				end = "ROLLBACK"
+			}
+			want := []string{"BEGIN", "SELECT pg_advisory_xact_lock($1, hashtext($2))", blobInUseSQL, end}
+			if got := f.SQL(); !reflect.DeepEqual(got, want) {
+				t.Errorf("queries %q, want %q", got, want)
+			}
+		})
+	}
+}
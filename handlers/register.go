@@ -1,19 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
-	"fmt"
-	"html/template"
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
 	"net/smtp"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"os"
+	"site/metrics"
+	"site/views"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type User struct {
@@ -27,27 +32,66 @@ type User struct {
 var users = make(map[string]User)
 var mu sync.Mutex
 
-func connectToDB() (*sql.DB, error) {
-	dsn := os.Getenv("DATABASE_PUBLIC_URL")
-	if dsn == "" {
-		dsn = "host=nozomi.proxy.rlwy.net port=10901 user=postgres password=AqbxOKFcClXSBPUvcvSUZBiOVorFdUfW dbname=railway sslmode=disable"
-	}
-	return sql.Open("postgres", dsn)
+// Handlers — обработчики регистрации и подтверждения почты
+type Handlers struct {
+	// Templates — шаблоны страниц
+	Templates *views.Registry
+	// DB — общий пул соединений сайта
+	DB *sql.DB
 }
 
+// emailsSent — отправленные письма с кодом подтверждения, result = success|failure
+var emailsSent = metrics.NewCounterVec("email_send_total", "Отправка писем с кодом подтверждения.", "result")
+
 func generateConfirmationCode() string {
 	bytes := make([]byte, 6)
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
 
-func sendEmail(to, code string) {
-	from := "nkayet@yandex.ru"
-	password := "tvmnkyymrebzlhoy" // Пароль приложения
-	smtpHost := "smtp.yandex.ru"
-	smtpPort := "587"
+// mailSettings — почтовый ящик для писем с кодом подтверждения. Все поля обязательны
+// и задаются только окружением: SMTP_FROM, SMTP_PASSWORD (пароль приложения), SMTP_HOST, SMTP_PORT.
+type mailSettings struct {
+	From, Password, Host, Port string
+}
 
-	auth := smtp.PlainAuth("", from, password, smtpHost)
+// mailEnv — переменные окружения почты в порядке, в котором о них сообщает MailerConfigured
+var mailEnv = []string{"SMTP_FROM", "SMTP_PASSWORD", "SMTP_HOST", "SMTP_PORT"}
+
+func mailConfig() mailSettings {
+	return mailSettings{
+		From:     os.Getenv("SMTP_FROM"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+	}
+}
+
+// MailerConfigured сообщает, заданы ли все настройки отправки почты (для /readyz);
+// в ошибке перечислены все незаданные переменные
+func MailerConfigured() error {
+	var missing []string
+	for _, name := range mailEnv {
+		if strings.TrimSpace(os.Getenv(name)) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return errors.New("не заданы " + strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func sendEmail(to, code string) error {
+	if err := MailerConfigured(); err != nil {
+		emailsSent.Inc("failure")
+		slog.Error("sending email failed", "to", views.LogEmail(to), "err", err)
+		return err
+	}
+	c := mailConfig()
+	from, smtpHost, smtpPort := c.From, c.Host, c.Port
+
+	auth := smtp.PlainAuth("", from, c.Password, smtpHost)
 	msg := []byte("To: " + to + "\r\n" +
 		"Subject: Confirm your account\r\n" +
 		"\r\n" +
@@ -55,15 +99,144 @@ func sendEmail(to, code string) {
 
 	err := smtp.SendMail(smtpHost+":"+smtpPort, auth, from, []string{to}, msg)
 	if err != nil {
-		log.Println("Error sending email:", err)
+		emailsSent.Inc("failure")
+		slog.Error("sending email failed", "to", views.LogEmail(to), "err", err)
+		return err
+	}
+	emailsSent.Inc("success")
+	slog.Info("email sent", "to", views.LogEmail(to))
+	return nil
+}
+
+// resendWorkers — сколько писем очередь повторной отправки отправляет одновременно
+const resendWorkers = 4
+
+// resendQueueSize — сколько адресов может ждать повторной отправки кода
+const resendQueueSize = 1000
+
+// resendSaveTimeout — сколько ждать записи нового кода в базу после отправки письма
+const resendSaveTimeout = 10 * time.Second
+
+// resendQueue — адреса, которым RunResendQueue отправит новый код подтверждения
+var resendQueue = make(chan string, resendQueueSize)
+
+// resendFailed — адреса, на которые последняя повторная отправка не ушла; у них остался прежний код
+var resendFailed = struct {
+	sync.Mutex
+	emails map[string]bool
+}{emails: make(map[string]bool)}
+
+// QueueResends ставит неподтверждённых пользователей из emails в очередь повторной отправки кода
+// и возвращает, сколько адресов поставлено. Подтверждённые (уже есть в users) и неизвестные
+// адреса пропускаются; если очередь заполнена, оставшиеся адреса тоже.
+func QueueResends(ctx context.Context, db *sql.DB, emails []string) (int, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT DISTINCT r.email FROM regist r
+          WHERE r.email = ANY($1) AND NOT r.confirmed
+            AND NOT EXISTS (SELECT 1 FROM users u WHERE u.email = r.email)
+          ORDER BY r.email`,
+		pq.Array(emails),
+	)
+	if err != nil {
+		return 0, err
+	}
+	var pending []string
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	queued := 0
+	for _, email := range pending {
+		select {
+		case resendQueue <- email:
+			queued++
+		default:
+			slog.Warn("resend queue is full", "to", views.LogEmail(email))
+		}
+	}
+	return queued, nil
+}
+
+// RunResendQueue отправляет коды из очереди в resendWorkers потоков, пока не отменён ctx.
+// Письмо, которое уже начали отправлять, доотправляется и после отмены.
+func RunResendQueue(ctx context.Context, db *sql.DB) {
+	var wg sync.WaitGroup
+	for i := 0; i < resendWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case email := <-resendQueue:
+					resendConfirmation(ctx, db, email)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ResendFailures — адреса, на которые последняя повторная отправка кода не ушла, по алфавиту
+func ResendFailures() []string {
+	resendFailed.Lock()
+	defer resendFailed.Unlock()
+	emails := make([]string, 0, len(resendFailed.emails))
+	for email := range resendFailed.emails {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	return emails
+}
+
+// resendConfirmation отправляет email новый код и только после этого записывает его в базу:
+// если письмо не ушло, пользователь по-прежнему может ввести код из прошлого письма.
+// Код записывается и после отмены ctx — иначе у пользователя окажется код, которого нет в базе.
+func resendConfirmation(ctx context.Context, db *sql.DB, email string) {
+	code := generateConfirmationCode()
+	err := sendEmail(email, code)
+	if err == nil {
+		saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), resendSaveTimeout)
+		_, err = db.ExecContext(saveCtx,
+			"UPDATE regist SET confirmation_code = $1 WHERE email = $2 AND NOT confirmed", code, email)
+		cancel()
+		if err != nil {
+			slog.Error("saving confirmation code failed", "to", views.LogEmail(email), "err", err)
+		}
+	}
+
+	resendFailed.Lock()
+	if err != nil {
+		resendFailed.emails[email] = true
 	} else {
-		log.Println("Email sent to:", to)
+		delete(resendFailed.emails, email)
 	}
+	resendFailed.Unlock()
+	if err != nil {
+		return
+	}
+
+	mu.Lock()
+	if user, ok := users[email]; ok {
+		user.ConfirmationCode = code
+		users[email] = user
+	}
+	mu.Unlock()
 }
 
-func SaveUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) SaveUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		h.Templates.Error(w, r, &views.Error{Status: http.StatusMethodNotAllowed, Message: "Invalid request method"})
 		return
 	}
 
@@ -72,12 +245,12 @@ func SaveUser(w http.ResponseWriter, r *http.Request) {
 	passwordConfirm := r.FormValue("password_confirm")
 
 	if email == "" || password == "" || passwordConfirm == "" {
-		http.Error(w, "Не все данные", http.StatusBadRequest)
+		h.Templates.Error(w, r, views.BadRequest("Не все данные"))
 		return
 	}
 
 	if password != passwordConfirm {
-		http.Error(w, "Passwords do not match", http.StatusBadRequest)
+		h.Templates.Error(w, r, views.BadRequest("Passwords do not match"))
 		return
 	}
 
@@ -95,54 +268,37 @@ func SaveUser(w http.ResponseWriter, r *http.Request) {
 
 	sendEmail(email, confirmationCode)
 
-	db, err := connectToDB()
-	if err != nil {
-		http.Error(w, "Database connection error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
-	_, err = db.Exec(
+	_, err := h.DB.ExecContext(r.Context(),
 		`INSERT INTO regist (email, password, confirm_password, confirmation_code, confirmed)
 		 VALUES ($1, $2, $3, $4, $5)`,
 		email, password, passwordConfirm, confirmationCode, false,
 	)
 	if err != nil {
-		http.Error(w, "Database insert error: "+err.Error(), http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.Internal("Database insert error", err))
 		return
 	}
 
-	log.Println("User registered with email:", email)
+	slog.Info("user registered", "email", views.LogEmail(email))
 	http.Redirect(w, r, "/confirm?email="+email, http.StatusSeeOther)
 }
 
-func Register(w http.ResponseWriter, r *http.Request) {
-	t, err := template.ParseFiles("html/reg.html", "html/header_for_connect.html")
-	if err != nil {
-		fmt.Fprintf(w, err.Error())
-		return
-	}
-	t.ExecuteTemplate(w, "reg", nil)
+func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
+	h.Templates.Render(w, r, http.StatusOK, "reg", nil)
 }
 
-func ConfirmPage(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ConfirmPage(w http.ResponseWriter, r *http.Request) {
 	email := r.URL.Query().Get("email")
 	if email == "" {
-		http.Error(w, "Email is required", http.StatusBadRequest)
+		h.Templates.Error(w, r, views.BadRequest("Email is required"))
 		return
 	}
 
-	t, err := template.ParseFiles("html/confirm.html", "html/header_for_connect.html")
-	if err != nil {
-		fmt.Fprintf(w, err.Error())
-		return
-	}
-	t.ExecuteTemplate(w, "confirm", map[string]string{"Email": email})
+	h.Templates.Render(w, r, http.StatusOK, "confirm", map[string]string{"Email": email})
 }
 
-func ConfirmUser(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ConfirmUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		h.Templates.Error(w, r, &views.Error{Status: http.StatusMethodNotAllowed, Message: "Invalid request method"})
 		return
 	}
 
@@ -153,12 +309,12 @@ func ConfirmUser(w http.ResponseWriter, r *http.Request) {
 	user, exists := users[email]
 	mu.Unlock()
 	if !exists {
-		http.Error(w, "User not found", http.StatusBadRequest)
+		h.Templates.Error(w, r, views.BadRequest("User not found"))
 		return
 	}
 
 	if user.ConfirmationCode != code {
-		http.Error(w, "Invalid confirmation code", http.StatusBadRequest)
+		h.Templates.Error(w, r, views.BadRequest("Invalid confirmation code"))
 		return
 	}
 
@@ -167,80 +323,74 @@ func ConfirmUser(w http.ResponseWriter, r *http.Request) {
 	users[email] = user
 	mu.Unlock()
 
-	db, err := connectToDB()
-	if err != nil {
-		http.Error(w, "Database connection error: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer db.Close()
-
 	// Обновляем поле confirmed в PostgreSQL; используем $1 и $2
-	_, err = db.Exec(
+	_, err := h.DB.ExecContext(r.Context(),
 		`UPDATE regist SET confirmed = $1
 		 WHERE email = $2`,
 		true, email,
 	)
 	if err != nil {
-		http.Error(w, "Database update error: "+err.Error(), http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.Internal("Database update error", err))
 		return
 	}
 
 	http.Redirect(w, r, "/confirmation-success", http.StatusSeeOther)
 }
 
-func ConfirmationSuccess(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, "html/confirmation-success.html")
+func (h *Handlers) ConfirmationSuccess(w http.ResponseWriter, r *http.Request) {
+	h.Templates.Render(w, r, http.StatusOK, "confirmation-success", nil)
 }
 
-func ConfirmEmailPage(w http.ResponseWriter, r *http.Request) {
-	t, err := template.ParseFiles("html/confirm_code.html", "html/header.html")
-	if err != nil {
-		http.Error(w, "Ошибка шаблона: "+err.Error(), http.StatusInternalServerError)
-		return
-	}
-	t.ExecuteTemplate(w, "confirm", nil)
+func (h *Handlers) ConfirmEmailPage(w http.ResponseWriter, r *http.Request) {
+	h.Templates.Render(w, r, http.StatusOK, "confirm_code", nil)
 }
 
-func ConfirmCodeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) ConfirmCodeHandler(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	code := r.FormValue("code")
 
 	if email == "" || code == "" {
-		http.Error(w, "Заполните все поля", http.StatusBadRequest)
-		return
-	}
-
-	db, err := connectToDB()
-	if err != nil {
-		http.Error(w, "Ошибка подключения к БД: "+err.Error(), http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.BadRequest("Заполните все поля"))
 		return
 	}
-	defer db.Close()
 
 	var dbCode string
 	var password string
 
-	err = db.QueryRow("SELECT confirmation_code, password FROM regist WHERE email = $1", email).Scan(&dbCode, &password)
+	err := h.DB.QueryRowContext(r.Context(), "SELECT confirmation_code, password FROM regist WHERE email = $1", email).Scan(&dbCode, &password)
 	if err == sql.ErrNoRows {
-		http.Error(w, "Пользователь не найден", http.StatusBadRequest)
+		h.Templates.Error(w, r, views.BadRequest("Пользователь не найден"))
 		return
 	} else if err != nil {
-		http.Error(w, "Ошибка чтения БД: "+err.Error(), http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.Internal("Ошибка чтения БД", err))
 		return
 	}
 
 	if dbCode != code {
-		http.Error(w, "Неверный код", http.StatusUnauthorized)
+		h.Templates.Error(w, r, views.Unauthorized("Неверный код"))
 		return
 	}
 
-	// Код верный — вставляем в users
-	_, err = db.Exec(
-		"INSERT INTO users (email, password) VALUES ($1, $2)",
+	// Код верный — создаём учётную запись (повторный ввод кода второй не создаёт)
+	// и отмечаем регистрацию подтверждённой
+	tx, err := h.DB.BeginTx(r.Context(), nil)
+	if err != nil {
+		h.Templates.Error(w, r, views.Internal("Ошибка добавления в users", err))
+		return
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(r.Context(),
+		"INSERT INTO users (email, password) SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM users WHERE email = $1)",
 		email, password,
 	)
+	if err == nil {
+		_, err = tx.ExecContext(r.Context(), "UPDATE regist SET confirmed = true WHERE email = $1", email)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
 	if err != nil {
-		http.Error(w, "Ошибка добавления в users: "+err.Error(), http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.Internal("Ошибка добавления в users", err))
 		return
 	}
 
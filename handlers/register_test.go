@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMailerConfigured(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		missing string // пусто — настройки полные
+	}{
+		{"none", map[string]string{}, "SMTP_FROM, SMTP_PASSWORD, SMTP_HOST, SMTP_PORT"},
+		{"no password", map[string]string{"SMTP_FROM": "site@example.com", "SMTP_HOST": "smtp.example.com", "SMTP_PORT": "587"}, "SMTP_PASSWORD"},
+		{"blank port", map[string]string{"SMTP_FROM": "site@example.com", "SMTP_PASSWORD": "x", "SMTP_HOST": "smtp.example.com", "SMTP_PORT": " "}, "SMTP_PORT"},
+		{"complete", map[string]string{"SMTP_FROM": "site@example.com", "SMTP_PASSWORD": "x", "SMTP_HOST": "smtp.example.com", "SMTP_PORT": "587"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range mailEnv {
+				t.Setenv(name, tt.env[name])
+			}
+			err := MailerConfigured()
+			if tt.missing == "" {
+				if err != nil {
+					t.Errorf("MailerConfigured() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasSuffix(err.Error(), tt.missing) {
+				t.Errorf("MailerConfigured() = %v, want it to list %s", err, tt.missing)
+			}
+		})
+	}
+
+	// Без настроек письмо не уходит на пустой адрес сервера, а сразу возвращает ошибку
+	for _, name := range mailEnv {
+		t.Setenv(name, "")
+	}
+	if err := sendEmail("user@example.com", "code"); err == nil {
+		t.Error("sendEmail without SMTP settings succeeded")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"site/handlers"
+	"site/views"
+	"strings"
+	"time"
+)
+
+// readyTimeout — сколько /readyz ждёт ответа БД, прежде чем признать её недоступной
+const readyTimeout = 2 * time.Second
+
+// healthzHandler — GET /healthz: процесс жив и обслуживает запросы; зависимости не проверяются,
+// чтобы оркестратор не перезапускал сервер из-за недоступной БД
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintln(w, "ok")
+}
+
+// readyzHandler — GET /readyz: сервер готов принимать трафик — БД отвечает,
+// все встроенные миграции применены, почта настроена. 200 или 503 с результатом каждой проверки.
+// Во время остановки сервера — всегда 503, зависимости уже не проверяются.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if shuttingDown.Load() {
+		writeReadiness(w, false, map[string]string{"server": "останавливается"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	checks := map[string]string{
+		"db":         "ok",
+		"migrations": "ok",
+		"mailer":     "ok",
+	}
+	ready := true
+	// Текст ошибки БД может содержать адрес сервера и имена таблиц — наружу отдаём только
+	// краткий итог, подробности уходят в журнал
+	fail := func(name, msg string, err error) {
+		checks[name] = msg
+		ready = false
+		slog.Warn("readiness check failed", "request_id", views.RequestID(r.Context()), "check", name, "err", err)
+	}
+
+	if err := checkDB(ctx); err != nil {
+		fail("db", "недоступна", err)
+		checks["migrations"] = "не проверялись"
+	} else if err := checkMigrations(ctx); err != nil {
+		fail("migrations", "не в актуальной версии", err)
+	}
+	if err := handlers.MailerConfigured(); err != nil {
+		fail("mailer", err.Error(), err)
+	}
+
+	writeReadiness(w, ready, checks)
+}
+
+// writeReadiness — ответ /readyz: 200, если ready, иначе 503, с итогом каждой проверки
+func writeReadiness(w http.ResponseWriter, ready bool, checks map[string]string) {
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"ready": ready, "checks": checks})
+}
+
+// checkDB проверяет, что пул может выдать живое соединение
+func checkDB(ctx context.Context) error {
+	pool, err := dbPool()
+	if err != nil {
+		return err
+	}
+	return pool.PingContext(ctx)
+}
+
+// checkMigrations проверяет, что схема БД в той версии, которую ждёт этот бинарник
+func checkMigrations(ctx context.Context) error {
+	pool, err := dbPool()
+	if err != nil {
+		return err
+	}
+	pending, err := pendingMigrations(&DB{DB: pool, ctx: ctx})
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("не применены: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadyzDuringShutdown(t *testing.T) {
+	shuttingDown.Store(true)
+	t.Cleanup(func() { shuttingDown.Store(false) })
+
+	rec := httptest.NewRecorder()
+	readyzHandler(rec, httptest.NewRequest("GET", "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status %d, want 503", rec.Code)
+	}
+	var body struct {
+		Ready  bool
+		Checks map[string]string
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Ready || body.Checks["server"] == "" {
+		t.Errorf("body %s", rec.Body)
+	}
+
+	// Живость от остановки не зависит: процесс ещё дорабатывает запросы
+	rec = httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("healthz status %d, want 200", rec.Code)
+	}
+}
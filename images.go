@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// imageTypes — форматы, которые processImage умеет декодировать и перекодировать
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif"}
+
+// errNotImage — загруженный файл не является поддерживаемым изображением
+var errNotImage = errors.New("файл не является изображением JPEG, PNG или GIF")
+
+// errTooManyPixels — размеры из заголовка изображения больше maxImagePixels
+var errTooManyPixels = errors.New("изображение слишком большое")
+
+// maxImagePixels — предел площади изображения; IMAGE_MAX_MEGAPIXELS, по умолчанию 40 Мп.
+// Маленький файл может объявить огромные размеры, а декодер выделит под них память целиком.
+func maxImagePixels() int {
+	return envInt("IMAGE_MAX_MEGAPIXELS", 40) * 1_000_000
+}
+
+// Rendition — один из размеров изображения, которые отдаёт /file/{id}?size=
+type Rendition struct {
+	Size   string
+	MaxDim int
+}
+
+// renditions — размеры по убыванию; "full" хранится в files.data, остальные в file_renditions
+var renditions = []Rendition{
+	{Size: "full", MaxDim: 2048},
+	{Size: "medium", MaxDim: 1024},
+	{Size: "thumb", MaxDim: 320},
+}
+
+// isRenditionSize — есть ли уменьшенная копия с таким именем
+func isRenditionSize(size string) bool {
+	for _, rd := range renditions[1:] {
+		if rd.Size == size {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodedImage — перекодированное изображение без метаданных
+type EncodedImage struct {
+	Size   string
+	Mime   string
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// processImage проверяет, что data — настоящее изображение не больше maxImagePixels,
+// поворачивает его по EXIF, перекодирует (метаданные при этом отбрасываются)
+// и строит все размеры из renditions
+func processImage(data []byte) ([]EncodedImage, error) {
+	mime := http.DetectContentType(data)
+	if !typeAllowed(mime, imageTypes) {
+		return nil, errNotImage
+	}
+
+	// Размеры читаем из заголовка до декодирования, чтобы не выделять память под пиксели
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, errNotImage
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > int64(maxImagePixels()) {
+		return nil, errTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errNotImage
+	}
+	if mime == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// GIF перекодируем в PNG: анимация всё равно теряется при ресайзе
+	if mime == "image/gif" {
+		mime = "image/png"
+	}
+
+	var out []EncodedImage
+	src := img
+	for _, rd := range renditions {
+		src = fitWithin(src, rd.MaxDim)
+		var buf bytes.Buffer
+		if mime == "image/jpeg" {
+			err = jpeg.Encode(&buf, src, &jpeg.Options{Quality: 85})
+		} else {
+			err = png.Encode(&buf, src)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b := src.Bounds()
+		out = append(out, EncodedImage{
+			Size:   rd.Size,
+			Mime:   mime,
+			Width:  b.Dx(),
+			Height: b.Dy(),
+			Data:   buf.Bytes(),
+		})
+	}
+	return out, nil
+}
+
+// fitWithin уменьшает изображение так, чтобы большая сторона была не больше maxDim
+func fitWithin(src image.Image, maxDim int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxDim && h <= maxDim {
+		return src
+	}
+	if w >= h {
+		h = max(1, h*maxDim/w)
+		w = maxDim
+	} else {
+		w = max(1, w*maxDim/h)
+		h = maxDim
+	}
+	return resizeBox(src, w, h)
+}
+
+// resizeBox уменьшает изображение усреднением по площади (box filter)
+func resizeBox(src image.Image, w, h int) *image.RGBA {
+	sb := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	sw, sh := sb.Dx(), sb.Dy()
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, max((y+1)*sh/h, y*sh/h+1)
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, max((x+1)*sw/w, x*sw/w+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				off := rgba.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint64(rgba.Pix[off])
+					g += uint64(rgba.Pix[off+1])
+					bl += uint64(rgba.Pix[off+2])
+					a += uint64(rgba.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			d := dst.PixOffset(x, y)
+			dst.Pix[d] = uint8(r / n)
+			dst.Pix[d+1] = uint8(g / n)
+			dst.Pix[d+2] = uint8(bl / n)
+			dst.Pix[d+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// jpegOrientation читает тег Orientation (0x0112) из EXIF-блока APP1; 1 — без поворота
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	i := 2
+	for i+4 <= len(data) && data[i] == 0xFF {
+		marker := data[i+1]
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || size < 2 || i+2+size > len(data) {
+			break
+		}
+		seg := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(seg) > 14 && string(seg[:6]) == "Exif\x00\x00" {
+			return exifOrientation(seg[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+// exifOrientation ищет Orientation в IFD0 TIFF-заголовка
+func exifOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < n; k++ {
+		e := ifd + 2 + k*12
+		if e+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[e:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[e+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			break
+		}
+	}
+	return 1
+}
+
+// applyOrientation поворачивает/отражает изображение согласно значению EXIF Orientation
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	sb := src.Bounds()
+	w, h := sb.Dx(), sb.Dy()
+	// Для 5–8 стороны меняются местами
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(sb.Min.X+x, sb.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngHeader — PNG из одного IHDR с заданными размерами, без пикселей:
+// DecodeConfig его читает, а полное декодирование выделило бы память под w×h
+func pngHeader(w, h uint32) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], w)
+	binary.BigEndian.PutUint32(ihdr[4:], h)
+	ihdr[8] = 8 // бит на канал
+	ihdr[9] = 6 // RGBA
+	chunk := append([]byte("IHDR"), ihdr...)
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestProcessImageRejectsOversizedHeader(t *testing.T) {
+	t.Setenv("IMAGE_MAX_MEGAPIXELS", "40")
+	_, err := processImage(pngHeader(100_000, 100_000))
+	if !errors.Is(err, errTooManyPixels) {
+		t.Fatalf("err = %v, want errTooManyPixels", err)
+	}
+}
+
+func TestProcessImageRejectsNonImage(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("<html><body>not an image</body></html>"),
+		[]byte("\x89PNG\r\n\x1a\n garbage"),
+		nil,
+	} {
+		if _, err := processImage(data); !errors.Is(err, errNotImage) {
+			t.Errorf("processImage(%q) err = %v, want errNotImage", data, err)
+		}
+	}
+}
+
+func TestProcessImageResizes(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 3000, 1500))
+	for y := 0; y < 1500; y++ {
+		for x := 0; x < 3000; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := processImage(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"full": {2048, 1024}, "medium": {1024, 512}, "thumb": {320, 160}}
+	if len(out) != len(want) {
+		t.Fatalf("got %d renditions, want %d", len(out), len(want))
+	}
+	for _, im := range out {
+		if im.Mime != "image/png" {
+			t.Errorf("%s: mime %s", im.Size, im.Mime)
+		}
+		if got := [2]int{im.Width, im.Height}; got != want[im.Size] {
+			t.Errorf("%s: %v, want %v", im.Size, got, want[im.Size])
+		}
+		cfg, err := png.DecodeConfig(bytes.NewReader(im.Data))
+		if err != nil || cfg.Width != im.Width || cfg.Height != im.Height {
+			t.Errorf("%s: encoded %dx%d, err %v", im.Size, cfg.Width, cfg.Height, err)
+		}
+	}
+}
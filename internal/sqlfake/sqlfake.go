@@ -0,0 +1,135 @@
+// Package sqlfake — драйвер database/sql для тестов без PostgreSQL: запоминает запросы
+// и отвечает на них функцией, которую задаёт тест
+package sqlfake
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Query — выполненный запрос с аргументами
+type Query struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// Result — ответ на запрос: строки для Query, число строк для Exec или ошибка
+type Result struct {
+	Cols     []string
+	Rows     [][]driver.Value
+	Affected int64
+	Err      error
+}
+
+// DB запоминает запросы и отвечает на них функцией respond; nil respond — пустой ответ на всё.
+// Транзакции попадают в список запросов как BEGIN, COMMIT и ROLLBACK.
+type DB struct {
+	mu      sync.Mutex
+	queries []Query
+	respond func(query string, args []driver.Value) Result
+}
+
+func New(respond func(query string, args []driver.Value) Result) *DB {
+	return &DB{respond: respond}
+}
+
+// Open — пул database/sql поверх f
+func (f *DB) Open() *sql.DB {
+	return sql.OpenDB(f)
+}
+
+// Queries — выполненные запросы по порядку
+func (f *DB) Queries() []Query {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Query(nil), f.queries...)
+}
+
+// SQL — тексты выполненных запросов по порядку
+func (f *DB) SQL() []string {
+	var qs []string
+	for _, q := range f.Queries() {
+		qs = append(qs, q.SQL)
+	}
+	return qs
+}
+
+// Reset забывает выполненные запросы
+func (f *DB) Reset() {
+	f.mu.Lock()
+	f.queries = nil
+	f.mu.Unlock()
+}
+
+func (f *DB) record(query string, args []driver.NamedValue) Result {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	f.mu.Lock()
+	f.queries = append(f.queries, Query{SQL: query, Args: values})
+	f.mu.Unlock()
+	if f.respond == nil {
+		return Result{}
+	}
+	return f.respond(query, values)
+}
+
+func (f *DB) Connect(context.Context) (driver.Conn, error) { return &conn{db: f}, nil }
+func (f *DB) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ db *DB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return &conn{db: d.db}, nil }
+
+type conn struct{ db *DB }
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("sqlfake: prepared statements are not supported")
+}
+func (c *conn) Close() error { return nil }
+func (c *conn) Begin() (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return tx{c.db}, nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	res := c.db.record(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return &rows{cols: res.Cols, rows: res.Rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res := c.db.record(query, args)
+	if res.Err != nil {
+		return nil, res.Err
+	}
+	return driver.RowsAffected(res.Affected), nil
+}
+
+type tx struct{ db *DB }
+
+func (t tx) Commit() error   { t.db.record("COMMIT", nil); return nil }
+func (t tx) Rollback() error { t.db.record("ROLLBACK", nil); return nil }
+
+type rows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *rows) Columns() []string { return r.cols }
+func (r *rows) Close() error      { return nil }
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
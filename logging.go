@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"site/login"
+	"site/views"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// setupLogging настраивает log/slog: LOG_FORMAT=json|text (по умолчанию text),
+// LOG_LEVEL=debug|info|warn|error (по умолчанию info). Вызовы пакета log идут туда же.
+func setupLogging() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = slog.LevelInfo
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(h))
+}
+
+// requestInfo — сведения о запросе для журнала, которые становятся известны по ходу обработки
+type requestInfo struct {
+	Route string
+	User  string
+}
+
+type requestInfoKey struct{}
+
+// setRequestUser запоминает пользователя запроса (например, владельца API-токена) для журнала
+func setRequestUser(r *http.Request, user string) {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		info.User = user
+	}
+}
+
+// statusRecorder запоминает код ответа и число отданных байт
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// ReadFrom сохраняет быстрый путь io.Copy (sendfile для http.ServeContent),
+// который иначе скрыла бы обёртка
+func (w *statusRecorder) ReadFrom(src io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(src)
+	} else {
+		n, err = io.Copy(writerOnly{w.ResponseWriter}, src)
+	}
+	w.bytes += n
+	return n, err
+}
+
+// Flush отправляет клиенту буферизованные данные, если это умеет исходный ResponseWriter
+func (w *statusRecorder) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// writerOnly прячет ReadFrom, чтобы io.Copy не зациклился на нём
+type writerOnly struct{ io.Writer }
+
+// logRequests пишет в журнал каждый запрос: метод, шаблон маршрута, код, время, объём и пользователя,
+// и считает его в метриках http_requests_total и http_request_duration_seconds.
+// Ставится внутри withRequestID, поэтому номер запроса уже в контексте.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info))
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		if info.User == "" {
+			info.User = login.UserEmail(r)
+		}
+		info.User = views.LogEmail(info.User)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		route := routeLabel(info.Route)
+		httpRequests.Inc(r.Method, route, strconv.Itoa(rec.status))
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case probeRoutes[info.Route]:
+			// Оркестратор опрашивает пробы каждые несколько секунд — в обычном журнале они лишние
+			level = slog.LevelDebug
+		}
+		slog.LogAttrs(r.Context(), level, "request",
+			slog.String("request_id", views.RequestID(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("route", info.Route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", msSince(start)),
+			slog.Int64("bytes", rec.bytes),
+			slog.String("user", info.User),
+		)
+	})
+}
+
+// probeRoutes — проверки живости и готовности, см. health.go
+var probeRoutes = map[string]bool{"/healthz": true, "/readyz": true}
+
+// msSince — миллисекунды с момента start
+func msSince(start time.Time) float64 {
+	return float64(time.Since(start).Microseconds()) / 1000
+}
+
+// routeTemplate — middleware маршрутизатора: сохраняет шаблон сработавшего маршрута
+// (/post/{id:[0-9]+}, а не /post/42), чтобы запросы в журнале группировались
+func routeTemplate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+			if route := mux.CurrentRoute(r); route != nil {
+				info.Route, _ = route.GetPathTemplate()
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
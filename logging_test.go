@@ -0,0 +1,31 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusRecorder(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &statusRecorder{ResponseWriter: rec}
+
+	if _, ok := any(w).(io.ReaderFrom); !ok {
+		t.Fatal("statusRecorder does not implement io.ReaderFrom")
+	}
+	n, err := io.Copy(w, strings.NewReader("hello"))
+	if err != nil || n != 5 {
+		t.Fatalf("io.Copy = %d, %v", n, err)
+	}
+	if err := http.NewResponseController(w).Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if !rec.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if w.status != http.StatusOK || w.bytes != 5 || rec.Body.String() != "hello" {
+		t.Errorf("status %d, bytes %d, body %q", w.status, w.bytes, rec.Body)
+	}
+}
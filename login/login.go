@@ -3,58 +3,61 @@ package login
 import (
 	"database/sql"
 	"net/http"
-
-	"os"
+	"site/metrics"
+	"site/views"
+	"time"
 
 	"github.com/gorilla/sessions"
-	_ "github.com/lib/pq"
 )
 
 type User struct {
-	Email, Password string
+	Email, Password, Role string
 }
 
-// connectToDB подключается к той же базе PostgreSQL
-func connectToDB() (*sql.DB, error) {
-	dsn := os.Getenv("DATABASE_PUBLIC_URL")
-	if dsn == "" {
-		dsn = "host=nozomi.proxy.rlwy.net port=10901 user=postgres password=AqbxOKFcClXSBPUvcvSUZBiOVorFdUfW dbname=railway sslmode=disable"
-	}
-	return sql.Open("postgres", dsn)
+// Handlers — обработчики входа и выхода
+type Handlers struct {
+	// Templates — шаблоны страниц ошибок
+	Templates *views.Registry
+	// DB — общий пул соединений сайта
+	DB *sql.DB
 }
 
+// loginFailures — неудачные попытки входа через форму (неверный email или пароль)
+var loginFailures = metrics.NewCounterVec("login_failures_total", "Неудачные попытки входа.")
+
 var Store = sessions.NewCookieStore([]byte("something-very-secret"))
 
+// SetSecureCookies задаёт флаги куки сессии: HttpOnly и SameSite=Lax всегда,
+// Secure — когда сайт обслуживается по HTTPS (иначе браузер не вернёт куку по HTTP)
+func SetSecureCookies(secure bool) {
+	Store.Options.HttpOnly = true
+	Store.Options.SameSite = http.SameSiteLaxMode
+	Store.Options.Secure = secure
+}
+
 // UserCheck — обработчик POST /UserCheck: проверяем email/password по таблице regist
-func UserCheck(w http.ResponseWriter, r *http.Request) {
+func (h *Handlers) UserCheck(w http.ResponseWriter, r *http.Request) {
 	email := r.FormValue("email")
 	password := r.FormValue("password")
 	if email == "" || password == "" {
-		http.Error(w, "Error empty login or password", http.StatusBadRequest)
-		return
-	}
-
-	db, err := connectToDB()
-	if err != nil {
-		http.Error(w, "Error connecting to the database", http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.BadRequest("Error empty login or password"))
 		return
 	}
-	defer db.Close()
 
 	// Получаем все записи из regist
-	res, err := db.Query("SELECT email, password FROM users")
+	res, err := h.DB.QueryContext(r.Context(), "SELECT email, password, role, banned_at IS NOT NULL FROM users")
 	if err != nil {
-		http.Error(w, "Error querying the database", http.StatusInternalServerError)
+		h.Templates.Error(w, r, views.Internal("Error querying the database", err))
 		return
 	}
 	defer res.Close()
 
 	var user User
-	var IsValidUser bool
+	var IsValidUser, banned bool
 	for res.Next() {
-		err := res.Scan(&user.Email, &user.Password)
+		err := res.Scan(&user.Email, &user.Password, &user.Role, &banned)
 		if err != nil {
-			http.Error(w, "Error reading database", http.StatusInternalServerError)
+			h.Templates.Error(w, r, views.Internal("Error reading database", err))
 			return
 		}
 		if user.Email == email && user.Password == password {
@@ -63,34 +66,83 @@ func UserCheck(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if IsValidUser && banned {
+		h.Templates.Error(w, r, views.Forbidden("Учётная запись заблокирована"))
+		return
+	}
 	if IsValidUser {
 		session, _ := Store.Get(r, "session-name")
 		session.Values["authenticated"] = true
 		session.Values["user_email"] = email
+		session.Values["role"] = user.Role
 		session.Save(r, w)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	} else {
-		http.Error(w, "Error no", http.StatusUnauthorized)
+		loginFailures.Inc()
+		h.Templates.Error(w, r, views.Unauthorized("Error no"))
 	}
 }
 
-// IsAuthenticated проверяет, залогинен ли пользователь, по куки‑сессии
+// IsAuthenticated проверяет, залогинен ли пользователь: по куки‑сессии или API-токену (см. Authenticate)
 func IsAuthenticated(r *http.Request) bool {
-	session, _ := Store.Get(r, "session-name")
-	auth, ok := session.Values["authenticated"].(bool)
-	return ok && auth
+	return CurrentPrincipal(r) != nil
 }
 
-// LogoutHandler обнуляет сессию и редиректит на /
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+// UserEmail возвращает email залогиненного пользователя или пустую строку
+func UserEmail(r *http.Request) string {
+	if p := CurrentPrincipal(r); p != nil {
+		return p.Email
+	}
+	return ""
+}
+
+// IsEditor — может ли пользователь править чужие статьи и откатывать правки (роли editor и admin)
+func IsEditor(r *http.Request) bool {
+	p := CurrentPrincipal(r)
+	return p != nil && p.IsEditor()
+}
+
+// IsAdmin — роль admin
+func IsAdmin(r *http.Request) bool {
+	p := CurrentPrincipal(r)
+	return p != nil && p.IsAdmin()
+}
+
+// EndSession удаляет куку сессии: пользователь выходит из системы
+func EndSession(w http.ResponseWriter, r *http.Request) error {
 	session, err := Store.Get(r, "session-name")
 	if err != nil {
-		http.Error(w, "Error getting session", http.StatusInternalServerError)
-		return
+		return err
 	}
 	session.Options.MaxAge = -1
-	if err := session.Save(r, w); err != nil {
-		http.Error(w, "Error saving session", http.StatusInternalServerError)
+	return session.Save(r, w)
+}
+
+// SessionCheckedAt — когда роль и блокировка пользователя сессии последний раз сверялись
+// с базой (см. MarkSessionChecked); нулевое время, если ни разу
+func SessionCheckedAt(r *http.Request) time.Time {
+	session, _ := Store.Get(r, "session-name")
+	if at, ok := session.Values["checked_at"].(int64); ok {
+		return time.Unix(at, 0)
+	}
+	return time.Time{}
+}
+
+// MarkSessionChecked запоминает в сессии текущую роль пользователя и время проверки at
+func MarkSessionChecked(w http.ResponseWriter, r *http.Request, role string, at time.Time) error {
+	session, err := Store.Get(r, "session-name")
+	if err != nil {
+		return err
+	}
+	session.Values["role"] = role
+	session.Values["checked_at"] = at.Unix()
+	return session.Save(r, w)
+}
+
+// LogoutHandler обнуляет сессию и редиректит на /
+func (h *Handlers) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if err := EndSession(w, r); err != nil {
+		h.Templates.Error(w, r, views.Internal("Error saving session", err))
 		return
 	}
 	http.Redirect(w, r, "/", http.StatusSeeOther)
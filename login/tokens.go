@@ -0,0 +1,140 @@
+package login
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Области доступа API-токенов
+const (
+	ScopeRead          = "read"
+	ScopeWritePosts    = "write:posts"
+	ScopeWriteComments = "write:comments"
+)
+
+// Scopes — все области в порядке показа на странице аккаунта
+var Scopes = []string{ScopeRead, ScopeWritePosts, ScopeWriteComments}
+
+// tokenPrefix помогает узнать токен в логах и сканерах секретов
+const tokenPrefix = "sk_"
+
+// ErrInvalidToken — токен не найден, отозван или его владелец удалён
+var ErrInvalidToken = errors.New("недействительный API-токен")
+
+// Principal — кто выполняет запрос: пользователь сессии или владелец API-токена
+type Principal struct {
+	Email string
+	Role  string
+	// Scopes — области токена; у сессии nil, ей доступно всё
+	Scopes  []string
+	TokenID int
+}
+
+// HasScope — разрешена ли область scope
+func (p *Principal) HasScope(scope string) bool {
+	if p.TokenID == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEditor — роли editor и admin
+func (p *Principal) IsEditor() bool {
+	return p.Role == "editor" || p.Role == "admin"
+}
+
+// IsAdmin — роль admin: доступ к /admin
+func (p *Principal) IsAdmin() bool {
+	return p.Role == "admin"
+}
+
+type principalKey struct{}
+
+// WithPrincipal кладёт пользователя в контекст запроса; его видят IsAuthenticated, UserEmail и IsEditor
+func WithPrincipal(r *http.Request, p *Principal) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+}
+
+// CurrentPrincipal — пользователь запроса: из контекста (см. Authenticate) или из сессии; nil для гостя
+func CurrentPrincipal(r *http.Request) *Principal {
+	if p, ok := r.Context().Value(principalKey{}).(*Principal); ok {
+		return p
+	}
+	session, _ := Store.Get(r, "session-name")
+	auth, _ := session.Values["authenticated"].(bool)
+	if !auth {
+		return nil
+	}
+	email, _ := session.Values["user_email"].(string)
+	role, _ := session.Values["role"].(string)
+	return &Principal{Email: email, Role: role}
+}
+
+// Authenticate определяет пользователя запроса: по заголовку Authorization: Bearer,
+// если он есть, иначе по куки-сессии. Токен ищется в db. Неверный токен — ErrInvalidToken, гость — nil без ошибки.
+func Authenticate(db *sql.DB, r *http.Request) (*Principal, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return CurrentPrincipal(r), nil
+	}
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	p := &Principal{}
+	err := db.QueryRowContext(r.Context(),
+		`SELECT t.id, t.user_email, u.role, t.scopes
+           FROM api_tokens t
+           JOIN users u ON u.email = t.user_email
+          WHERE t.token_hash = $1 AND t.revoked_at IS NULL AND u.banned_at IS NULL`,
+		HashToken(strings.TrimSpace(token)),
+	).Scan(&p.TokenID, &p.Email, &p.Role, pq.Array(&p.Scopes))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Время использования нужно только для страницы /account: пишем его не чаще раза в минуту,
+	// чтобы частые запросы одного клиента не превращались в запись строки на каждый
+	_, err = db.ExecContext(r.Context(),
+		`UPDATE api_tokens SET last_used_at = now()
+          WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')`,
+		p.TokenID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// NewToken создаёт случайный токен; в базу кладётся только его хэш
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken — SHA-256 токена в hex. Соль не нужна: токен сам по себе случайный и длинный.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
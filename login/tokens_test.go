@@ -0,0 +1,158 @@
+package login
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"site/internal/sqlfake"
+	"strings"
+	"testing"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(token, tokenPrefix) || len(token) < 40 {
+		t.Errorf("token %q", token)
+	}
+	if hash != HashToken(token) || !regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(hash) {
+		t.Errorf("hash %q does not match HashToken", hash)
+	}
+	if strings.Contains(hash, token) {
+		t.Error("hash contains the token")
+	}
+	other, _, _ := NewToken()
+	if other == token {
+		t.Error("two tokens are equal")
+	}
+	if HashToken(token) != HashToken(token) || HashToken(token) == HashToken(other) {
+		t.Error("HashToken is not a stable function of the token")
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	session := &Principal{Email: "a@example.com"}
+	token := &Principal{Email: "a@example.com", TokenID: 1, Scopes: []string{ScopeRead, ScopeWriteComments}}
+	noScopes := &Principal{Email: "a@example.com", TokenID: 2}
+	tests := []struct {
+		p     *Principal
+		scope string
+		want  bool
+	}{
+		{session, ScopeWritePosts, true},
+		{session, "anything", true},
+		{token, ScopeRead, true},
+		{token, ScopeWriteComments, true},
+		{token, ScopeWritePosts, false},
+		{token, "write", false},
+		{token, "READ", false},
+		{noScopes, ScopeRead, false},
+	}
+	for _, tt := range tests {
+		if got := tt.p.HasScope(tt.scope); got != tt.want {
+			t.Errorf("%+v HasScope(%q) = %v, want %v", tt.p, tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	const token = "sk_valid"
+	// Как и запрос Authenticate, фейк находит только действующий токен: отозванные токены
+	// и токены заблокированных пользователей запрос отсекает условиями WHERE
+	respond := func(query string, args []driver.Value) sqlfake.Result {
+		if strings.Contains(query, "FROM api_tokens t") {
+			res := sqlfake.Result{Cols: []string{"id", "user_email", "role", "scopes"}}
+			if args[0] == HashToken(token) {
+				res.Rows = [][]driver.Value{{int64(7), "a@example.com", "editor", []byte("{read,write:posts}")}}
+			}
+			return res
+		}
+		return sqlfake.Result{Affected: 1}
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		f := sqlfake.New(respond)
+		db := f.Open()
+		defer db.Close()
+		r := httptest.NewRequest("GET", "/api/v1/posts", nil)
+		r.Header.Set("Authorization", "Bearer "+token+" ")
+		p, err := Authenticate(db, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.TokenID != 7 || p.Email != "a@example.com" || p.Role != "editor" || strings.Join(p.Scopes, ",") != "read,write:posts" {
+			t.Errorf("principal %+v", p)
+		}
+
+		qs := f.Queries()
+		if len(qs) != 2 {
+			t.Fatalf("queries %q, want the lookup and the last_used_at update", f.SQL())
+		}
+		if qs[0].Args[0] != HashToken(token) {
+			t.Errorf("token looked up by %v, want its hash", qs[0].Args[0])
+		}
+		for _, cond := range []string{"revoked_at IS NULL", "banned_at IS NULL"} {
+			if !strings.Contains(qs[0].SQL, cond) {
+				t.Errorf("lookup does not check %s: %s", cond, qs[0].SQL)
+			}
+		}
+		if !strings.Contains(qs[1].SQL, "last_used_at") || qs[1].Args[0] != int64(7) {
+			t.Errorf("second query %q %v", qs[1].SQL, qs[1].Args)
+		}
+	})
+
+	for _, header := range []string{
+		"Bearer sk_revoked", // отозван, владелец заблокирован или токена нет — строки нет
+		"Bearer " + HashToken(token),
+		"Bearer ",
+		"Bearer",
+		"bearer " + token,
+		"Basic " + token,
+		token,
+	} {
+		t.Run("invalid "+header, func(t *testing.T) {
+			f := sqlfake.New(respond)
+			db := f.Open()
+			defer db.Close()
+			r := httptest.NewRequest("GET", "/api/v1/posts", nil)
+			r.Header.Set("Authorization", header)
+			p, err := Authenticate(db, r)
+			if !errors.Is(err, ErrInvalidToken) || p != nil {
+				t.Errorf("Authenticate = %+v, %v, want ErrInvalidToken", p, err)
+			}
+			for _, q := range f.SQL() {
+				if strings.HasPrefix(q, "UPDATE") {
+					t.Errorf("invalid token updated a row: %s", q)
+				}
+			}
+		})
+	}
+
+	t.Run("guest", func(t *testing.T) {
+		f := sqlfake.New(respond)
+		db := f.Open()
+		defer db.Close()
+		p, err := Authenticate(db, httptest.NewRequest("GET", "/api/v1/posts", nil))
+		if p != nil || err != nil {
+			t.Errorf("Authenticate = %+v, %v, want a guest", p, err)
+		}
+		if qs := f.SQL(); len(qs) != 0 {
+			t.Errorf("guest request queried %q", qs)
+		}
+	})
+
+	t.Run("db error", func(t *testing.T) {
+		db := sqlfake.New(func(string, []driver.Value) sqlfake.Result {
+			return sqlfake.Result{Err: errors.New("connection refused")}
+		}).Open()
+		defer db.Close()
+		r := httptest.NewRequest("GET", "/api/v1/posts", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if _, err := Authenticate(db, r); err == nil || errors.Is(err, ErrInvalidToken) {
+			t.Errorf("err = %v, want the database error, not ErrInvalidToken", err)
+		}
+	})
+}
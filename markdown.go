@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+	"net/http"
+	"site/views"
+	"strconv"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+)
+
+// markdown — конвертер Markdown → HTML; сырой HTML в тексте goldmark по умолчанию не пропускает
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+)
+
+// htmlPolicy — белый список тегов и атрибутов для пользовательского HTML
+var htmlPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.RequireNoFollowOnLinks(true)
+	p.AddTargetBlankToFullyQualifiedLinks(true)
+	return p
+}()
+
+// renderMarkdown превращает Markdown статьи в очищенный HTML;
+// media — галерея поста для ссылок вида ![подпись](media:1)
+func renderMarkdown(src string, media []Media) (template.HTML, error) {
+	ctx := parser.NewContext()
+	ctx.Set(mediaRefsKey, media)
+
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(src), &buf, parser.WithContext(ctx)); err != nil {
+		return "", err
+	}
+	return template.HTML(htmlPolicy.SanitizeBytes(buf.Bytes())), nil
+}
+
+// ensureRenderedHTML заполняет p.FullTextHTML, если кэш пуст (старые посты, откат ревизии),
+// и сохраняет результат в post.full_text_html
+func ensureRenderedHTML(db *DB, p *Post) error {
+	if p.FullTextHTML != "" {
+		return nil
+	}
+	media, err := loadPostMedia(db, p.Id)
+	if err != nil {
+		return err
+	}
+	html, err := renderMarkdown(p.Full_text, media)
+	if err != nil {
+		return err
+	}
+	p.FullTextHTML = html
+	if _, err := db.Exec("UPDATE post SET full_text_html = $1 WHERE id = $2", string(html), p.Id); err != nil {
+		// Кэш не критичен: страница всё равно покажется
+		log.Println("Cache rendered HTML error:", err)
+	}
+	return nil
+}
+
+// markdownPreviewHandler — POST /markdown/preview, HTML-фрагмент для живого предпросмотра в редакторе.
+// Если передан post_id, ссылки media:N берутся из галереи этого поста.
+func markdownPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeError(w, r, views.BadRequest("Ошибка разбора формы"))
+		return
+	}
+
+	var media []Media
+	if postID, err := strconv.Atoi(r.FormValue("post_id")); err == nil {
+		db, err := requestDB(r)
+		if err != nil {
+			writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+			return
+		}
+		defer db.Close()
+		if media, err = loadPostMedia(db, postID); err != nil {
+			writeError(w, r, views.Internal("Ошибка чтения галереи", err))
+			return
+		}
+	}
+
+	html, err := renderMarkdown(r.FormValue("text"), media)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка рендеринга Markdown", err))
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(html))
+}
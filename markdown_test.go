@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		want       []string
+		notContain []string
+	}{
+		{"разметка", "**жирный** и [ссылка](https://example.com)",
+			[]string{"<strong>жирный</strong>", `href="https://example.com"`, `rel="nofollow noopener"`, `target="_blank"`}, nil},
+		{"script", "до\n\n<script>alert(1)</script>\n\nпосле",
+			[]string{"до", "после"}, []string{"<script", "alert(1)</script>"}},
+		{"javascript: ссылка", "[нажми](javascript:alert(1))",
+			[]string{"нажми"}, []string{"javascript:"}},
+		{"сырой HTML", `<img src=x onerror="alert(1)"><iframe src="https://evil.example"></iframe>`,
+			nil, []string{"onerror", "<iframe", "<img"}},
+		{"встроенный HTML в строке", `текст <span onclick="x()">тут</span>`,
+			[]string{"текст", "тут"}, []string{"onclick", "<span"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderMarkdown(tt.src, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(got), s) {
+					t.Errorf("output %q lacks %q", got, s)
+				}
+			}
+			for _, s := range tt.notContain {
+				if strings.Contains(string(got), s) {
+					t.Errorf("output %q contains %q", got, s)
+				}
+			}
+		})
+	}
+}
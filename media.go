@@ -0,0 +1,326 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"site/blobstore"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Media — изображение из галереи поста. Alt и подпись хранятся в post_media: один файл
+// (см. дедупликацию в storeUpload) может стоять в разных постах с разным описанием.
+type Media struct {
+	Id       int
+	PostID   int
+	FileID   int
+	Position int
+	Caption  string
+	Alt      string
+	// Version — первые 16 символов ключа блоба (хэша содержимого), см. ServeFileHandler
+	Version string
+}
+
+// URL — адрес изображения нужного размера ("full", "medium", "thumb"). С версией URL
+// адресован по содержимому и кэшируется браузером навсегда (см. ServeFileHandler).
+func (m Media) URL(size string) string {
+	q := url.Values{}
+	if size != "" && size != "full" {
+		q.Set("size", size)
+	}
+	if m.Version != "" {
+		q.Set("v", m.Version)
+	}
+	u := "/file/" + strconv.Itoa(m.FileID)
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// queryer — общий интерфейс *sql.DB и *sql.Tx для чтения
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadPostMedia возвращает галерею поста в порядке показа
+func loadPostMedia(db queryer, postID int) ([]Media, error) {
+	rows, err := db.Query(
+		`SELECT m.id, m.post_id, m.file_id, m.position, m.caption, m.alt, COALESCE(LEFT(f.blob_key, 16), '')
+           FROM post_media m JOIN files f ON f.id = m.file_id
+          WHERE m.post_id = $1
+          ORDER BY m.position, m.id`,
+		postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var media []Media
+	for rows.Next() {
+		var m Media
+		if err := rows.Scan(&m.Id, &m.PostID, &m.FileID, &m.Position, &m.Caption, &m.Alt, &m.Version); err != nil {
+			return nil, err
+		}
+		media = append(media, m)
+	}
+	return media, rows.Err()
+}
+
+// storeUpload проверяет и перекодирует загруженное изображение (см. processImage),
+// кладёт все размеры в хранилище блобов и записывает их в files и file_renditions.
+// Если такой же файл уже загружался, возвращает id существующей строки.
+func storeUpload(db *DB, up *Upload) (int, error) {
+	// Повторно используемый файл может быть сиротой старше fileGCGrace. Обновление created_at
+	// выводит его из-под сборщика: UPDATE ждёт блокировку, которую держит идущая сборка
+	// (collectGarbageFiles, FOR UPDATE), и не найдёт строку, если та успела её удалить, —
+	// тогда файл просто загружается заново
+	var existing int
+	err := db.QueryRow(
+		`UPDATE files SET created_at = now()
+          WHERE id = (SELECT id FROM files WHERE source_hash = $1 ORDER BY id LIMIT 1)
+         RETURNING id`,
+		up.Hash,
+	).Scan(&existing)
+	if err == nil {
+		return existing, nil
+	} else if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	// Декодеру изображений нужен весь файл; в память читаем уже после проверки размера
+	data, err := os.ReadFile(up.Path)
+	if err != nil {
+		return 0, err
+	}
+	images, err := processImage(data)
+	if errors.Is(err, errNotImage) {
+		return 0, &UploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("Файл %q: %s", up.Filename, err.Error()),
+		}
+	} else if errors.Is(err, errTooManyPixels) {
+		return 0, &UploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Файл %q: изображение больше допустимых %d Мп", up.Filename, maxImagePixels()/1_000_000),
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	store, err := defaultBlobStore(db)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Блоб с тем же содержимым мог как раз остаться без ссылок. Разделяемая блокировка ключа
+	// (см. lockBlob) держится до фиксации строк files: сборщик не удалит блоб между Put и INSERT.
+	keys := make([]string, len(images))
+	for i, im := range images {
+		keys[i] = blobstore.Key(im.Data)
+		if err := lockBlob(db.ctx, tx, keys[i], true); err != nil {
+			return 0, err
+		}
+		if err := store.Put(db.ctx, keys[i], im.Data); err != nil {
+			return 0, err
+		}
+	}
+
+	var id int
+	full := images[0]
+	err = tx.QueryRow(
+		`INSERT INTO files (name, description, mime_type, blob_key, storage, source_hash, size)
+         VALUES ($1, $2, $3, $4, $5, $6, $7)
+         RETURNING id`,
+		up.Filename, "", full.Mime, keys[0], store.Name(), up.Hash, len(full.Data),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	for i, im := range images[1:] {
+		_, err = tx.Exec(
+			`INSERT INTO file_renditions (file_id, size, mime_type, width, height, blob_key, storage)
+             VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+			id, im.Size, im.Mime, im.Width, im.Height, keys[i+1], store.Name(),
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// storeUploads сохраняет все файлы одного поля формы (input multiple)
+func storeUploads(db *DB, ups []*Upload) ([]int, error) {
+	var ids []int
+	for _, up := range ups {
+		id, err := storeUpload(db, up)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// appendPostMedia добавляет файлы в конец галереи поста; файл, уже лежащий в галерее, пропускается
+func appendPostMedia(db execer, postID int, fileIDs []int) error {
+	for _, fid := range fileIDs {
+		_, err := db.Exec(
+			`INSERT INTO post_media (post_id, file_id, position)
+             SELECT $1, $2, COALESCE(MAX(position), 0) + 1 FROM post_media WHERE post_id = $1
+             ON CONFLICT (post_id, file_id) DO NOTHING`,
+			postID, fid,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMediaEdits применяет правки галереи из edit.html: удаление, порядок, подписи и alt
+func applyMediaEdits(db execer, form url.Values, postID int) error {
+	for _, v := range form["remove_media"] {
+		mid, err := strconv.Atoi(v)
+		if err != nil {
+			continue
+		}
+		if _, err := db.Exec("DELETE FROM post_media WHERE id = $1 AND post_id = $2", mid, postID); err != nil {
+			return err
+		}
+	}
+
+	for key := range form {
+		idStr, ok := strings.CutPrefix(key, "media_position_")
+		if !ok {
+			continue
+		}
+		mid, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		pos, err := strconv.Atoi(form.Get(key))
+		if err != nil {
+			pos = 0
+		}
+		_, err = db.Exec(
+			"UPDATE post_media SET position = $1, caption = $2, alt = $3 WHERE id = $4 AND post_id = $5",
+			pos, form.Get("media_caption_"+idStr), form.Get("media_alt_"+idStr), mid, postID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeMedia перенумеровывает галерею с 1 и делает первое изображение обложкой (post.photo_id)
+func normalizeMedia(db execer, postID int) error {
+	_, err := db.Exec(
+		`UPDATE post_media m SET position = o.rn
+           FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY position, id) AS rn
+                   FROM post_media WHERE post_id = $1) o
+          WHERE m.id = o.id`,
+		postID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(
+		`UPDATE post SET photo_id = (
+             SELECT file_id FROM post_media WHERE post_id = $1 ORDER BY position LIMIT 1
+         ) WHERE id = $1`,
+		postID,
+	)
+	return err
+}
+
+// promoteCover ставит текущий post.photo_id первым в галерее (например, после отката ревизии)
+func promoteCover(db execer, postID int) error {
+	_, err := db.Exec(
+		`INSERT INTO post_media (post_id, file_id, position)
+         SELECT id, photo_id, 0 FROM post WHERE id = $1 AND photo_id IS NOT NULL
+         ON CONFLICT (post_id, file_id) DO UPDATE SET position = 0`,
+		postID,
+	)
+	if err != nil {
+		return err
+	}
+	return normalizeMedia(db, postID)
+}
+
+// mediaRefsKey — ключ контекста парсера, в котором лежит галерея для ссылок media:N
+var mediaRefsKey = parser.NewContextKey()
+
+// mediaRefTransformer заменяет адреса вида media:N в картинках и ссылках Markdown
+// на /file/{id} N-го изображения галереи; пустой alt берётся из alt изображения в галерее
+type mediaRefTransformer struct{}
+
+func (mediaRefTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	media, _ := pc.Get(mediaRefsKey).([]Media)
+
+	resolve := func(dest []byte) (*Media, bool) {
+		n, ok := strings.CutPrefix(string(dest), "media:")
+		if !ok {
+			return nil, false
+		}
+		pos, err := strconv.Atoi(n)
+		if err != nil || pos < 1 || pos > len(media) {
+			return nil, true
+		}
+		return &media[pos-1], true
+	}
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Image:
+			if m, ok := resolve(node.Destination); ok {
+				if m == nil {
+					node.Destination = nil
+					return ast.WalkSkipChildren, nil
+				}
+				node.Destination = []byte(m.URL("medium"))
+				if !node.HasChildren() && m.Alt != "" {
+					node.AppendChild(node, ast.NewString([]byte(m.Alt)))
+				}
+				if node.Title == nil && m.Caption != "" {
+					node.Title = []byte(m.Caption)
+				}
+			}
+		case *ast.Link:
+			if m, ok := resolve(node.Destination); ok {
+				if m == nil {
+					node.Destination = nil
+				} else {
+					node.Destination = []byte(m.URL("full"))
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func init() {
+	markdown.Parser().AddOptions(parser.WithASTTransformers(
+		util.Prioritized(mediaRefTransformer{}, 100),
+	))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMediaRefTransformer(t *testing.T) {
+	media := []Media{
+		{FileID: 10, Alt: "кот на окне", Caption: "Утро", Version: "abcdef0123456789"},
+		{FileID: 20},
+	}
+	tests := []struct {
+		name       string
+		src        string
+		want       []string
+		notContain []string
+	}{
+		{"картинка", "![](media:1)",
+			[]string{`src="/file/10?size=medium&amp;v=abcdef0123456789"`, `alt="кот на окне"`, `title="Утро"`}, nil},
+		{"свой alt и title", `![свой](media:1 "Своя подпись")`,
+			[]string{`alt="свой"`, `title="Своя подпись"`}, []string{"кот на окне", "Утро"}},
+		{"ссылка на оригинал", "[оригинал](media:2)",
+			[]string{`href="/file/20"`}, []string{"media:"}},
+		{"номер вне галереи", "![x](media:3) [y](media:0)",
+			nil, []string{"media:", "/file/"}},
+		{"не число", "![x](media:abc)", nil, []string{"media:", "/file/"}},
+		{"обычные адреса не трогаются", "![x](/img/a.png)", []string{`src="/img/a.png"`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderMarkdown(tt.src, media)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(got), s) {
+					t.Errorf("output %q lacks %q", got, s)
+				}
+			}
+			for _, s := range tt.notContain {
+				if strings.Contains(string(got), s) {
+					t.Errorf("output %q contains %q", got, s)
+				}
+			}
+		})
+	}
+}
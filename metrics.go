@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"net/http"
+	"os"
+	"site/login"
+	"site/metrics"
+	"site/views"
+	"strings"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total",
+		"Число HTTP-запросов по методу, шаблону маршрута и коду ответа.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"Время обработки HTTP-запроса по шаблону маршрута.", metrics.DefBuckets, "method", "route")
+
+	dbQueryDuration = metrics.NewHistogramVec("db_query_duration_seconds",
+		"Время выполнения запросов к БД.", metrics.DefBuckets)
+
+	// uploadSize — от 16 КБ до 64 МБ, каждая следующая граница вчетверо больше
+	uploadSize = metrics.NewHistogramVec("upload_size_bytes",
+		"Размер загруженных файлов в байтах.", []float64{16 << 10, 64 << 10, 256 << 10, 1 << 20, 4 << 20, 16 << 20, 64 << 20})
+)
+
+// Статистика общего пула соединений читается в момент запроса /metrics
+func init() {
+	stat := func(f func(s sql.DBStats) float64) func() float64 {
+		return func() float64 {
+			pool, err := dbPool()
+			if err != nil {
+				return 0
+			}
+			return f(pool.Stats())
+		}
+	}
+	metrics.NewGaugeFunc("db_max_open_connections", "Предел открытых соединений с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	metrics.NewGaugeFunc("db_open_connections", "Открытые соединения с БД.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	metrics.NewGaugeFunc("db_in_use_connections", "Соединения с БД, занятые запросами.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	metrics.NewGaugeFunc("db_idle_connections", "Свободные соединения с БД в пуле.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	metrics.NewCounterFunc("db_wait_count_total", "Сколько раз запросу пришлось ждать свободного соединения.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	metrics.NewCounterFunc("db_wait_duration_seconds_total", "Суммарное время ожидания свободного соединения.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+}
+
+// routeLabel — метка маршрута для метрик: для несовпавших путей шаблона нет,
+// а сам путь в метку класть нельзя — число рядов выросло бы без предела
+func routeLabel(route string) string {
+	if route == "" {
+		return "unmatched"
+	}
+	return route
+}
+
+// metricsHandler — GET /metrics. Сборщик метрик предъявляет Authorization: Bearer со значением
+// METRICS_TOKEN; без токена метрики видны только администратору сайта.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if !metricsAllowed(r) {
+		writeError(w, r, views.Forbidden("Метрики доступны только по токену METRICS_TOKEN или администратору"))
+		return
+	}
+	metrics.Handler().ServeHTTP(w, r)
+}
+
+func metricsAllowed(r *http.Request) bool {
+	if want := os.Getenv("METRICS_TOKEN"); want != "" {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(got)), []byte(want)) == 1 {
+			return true
+		}
+	}
+	return login.IsAdmin(r)
+}
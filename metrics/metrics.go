@@ -0,0 +1,247 @@
+// Package metrics — минимальные счётчики и гистограммы в текстовом формате Prometheus
+// без внешних зависимостей. Метрики регистрируются при создании и отдаются Handler.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets — границы гистограммы времени ответа в секундах (как в client_golang)
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	mu       sync.Mutex
+	registry []metric
+)
+
+func register(m metric) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range registry {
+		if r.name() == m.name() {
+			panic("metrics: duplicate metric " + m.name())
+		}
+	}
+	registry = append(registry, m)
+}
+
+// labelKey склеивает значения меток в ключ карты
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// formatLabels — {a="1",b="2"}; extra добавляется последней парой (например le для гистограмм)
+func formatLabels(names, values []string, extra ...string) string {
+	var parts []string
+	for i, n := range names {
+		parts = append(parts, n+`="`+escape(values[i])+`"`)
+	}
+	if len(extra) == 2 {
+		parts = append(parts, extra[0]+`="`+extra[1]+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CounterVec — монотонный счётчик с метками
+type CounterVec struct {
+	metricName, help string
+	labels           []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	v      float64
+}
+
+// NewCounterVec создаёт и регистрирует счётчик; без меток — labels не передаются
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, labels: labels, values: make(map[string]*counterValue)}
+	if len(labels) == 0 {
+		// Ряд без меток виден с нуля, ещё до первого события
+		c.values[""] = &counterValue{}
+	}
+	register(c)
+	return c
+}
+
+// Inc увеличивает счётчик с данными значениями меток на 1
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add увеличивает счётчик на v
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if len(labelValues) != len(c.labels) {
+		panic("metrics: wrong number of labels for " + c.metricName)
+	}
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labels: append([]string(nil), labelValues...)}
+		c.values[key] = cv
+	}
+	cv.v += v
+	c.mu.Unlock()
+}
+
+func (c *CounterVec) name() string { return c.metricName }
+
+func (c *CounterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.metricName, c.help, c.metricName)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		cv := c.values[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.metricName, formatLabels(c.labels, cv.labels), formatFloat(cv.v))
+	}
+}
+
+// HistogramVec — гистограмма с метками
+type HistogramVec struct {
+	metricName, help string
+	labels           []string
+	buckets          []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // по корзинам, не накопительно
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec создаёт и регистрирует гистограмму с границами buckets (по возрастанию)
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{metricName: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+	if len(labels) == 0 {
+		h.values[""] = &histogramValue{counts: make([]uint64, len(buckets))}
+	}
+	register(h)
+	return h
+}
+
+// Observe добавляет наблюдение v
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic("metrics: wrong number of labels for " + h.metricName)
+	}
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+	h.mu.Unlock()
+}
+
+func (h *HistogramVec) name() string { return h.metricName }
+
+func (h *HistogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.metricName, h.help, h.metricName)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		var cum uint64
+		for i, le := range h.buckets {
+			cum += hv.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, hv.labels, "le", formatFloat(le)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, formatLabels(h.labels, hv.labels, "le", "+Inf"), hv.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labels, hv.labels), formatFloat(hv.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, hv.labels), hv.count)
+	}
+}
+
+// GaugeFunc — значение, которое читается в момент выдачи метрик (например, статистика пула БД)
+type GaugeFunc struct {
+	metricName, help, kind string
+	fn                     func() float64
+}
+
+// NewGaugeFunc регистрирует gauge, значение которого возвращает fn
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, kind: "gauge", fn: fn}
+	register(g)
+	return g
+}
+
+// NewCounterFunc — то же для уже накопленного где-то монотонного счётчика
+func NewCounterFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{metricName: name, help: help, kind: "counter", fn: fn}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) name() string { return g.metricName }
+
+func (g *GaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", g.metricName, g.help, g.metricName, g.kind, g.metricName, formatFloat(g.fn()))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteTo пишет все метрики в текстовом формате Prometheus, по алфавиту имён
+func WriteTo(w io.Writer) {
+	mu.Lock()
+	ms := append([]metric(nil), registry...)
+	mu.Unlock()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name() < ms[j].name() })
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Handler — GET /metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteTo(w)
+	})
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// emptyRegistry очищает реестр на время теста: метрики регистрируются глобально,
+// и повторный запуск (-count) иначе упал бы на дубликатах
+func emptyRegistry(t *testing.T) {
+	mu.Lock()
+	saved := registry
+	registry = nil
+	mu.Unlock()
+	t.Cleanup(func() {
+		mu.Lock()
+		registry = saved
+		mu.Unlock()
+	})
+}
+
+func TestWriteTo(t *testing.T) {
+	emptyRegistry(t)
+	requests := NewCounterVec("test_requests_total", "Запросы.", "method", "status")
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Add(3, "POST", "500")
+
+	events := NewCounterVec("test_events_total", "События без меток.")
+
+	duration := NewHistogramVec("test_duration_seconds", "Время.", []float64{0.1, 1}, "route")
+	duration.Observe(0.05, `/post/{id}`)
+	duration.Observe(0.5, `/post/{id}`)
+	duration.Observe(2, `/post/{id}`)
+	duration.Observe(0.1, "a\"b\\c\nd")
+
+	NewGaugeFunc("test_connections", "Соединения.", func() float64 { return 7 })
+	NewCounterFunc("test_wait_seconds_total", "Ожидание.", func() float64 { return 1.5 })
+
+	var b strings.Builder
+	WriteTo(&b)
+
+	want := `# HELP test_connections Соединения.
+# TYPE test_connections gauge
+test_connections 7
+# HELP test_duration_seconds Время.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/post/{id}",le="0.1"} 1
+test_duration_seconds_bucket{route="/post/{id}",le="1"} 2
+test_duration_seconds_bucket{route="/post/{id}",le="+Inf"} 3
+test_duration_seconds_sum{route="/post/{id}"} 2.55
+test_duration_seconds_count{route="/post/{id}"} 3
+test_duration_seconds_bucket{route="a\"b\\c\nd",le="0.1"} 1
+test_duration_seconds_bucket{route="a\"b\\c\nd",le="1"} 1
+test_duration_seconds_bucket{route="a\"b\\c\nd",le="+Inf"} 1
+test_duration_seconds_sum{route="a\"b\\c\nd"} 0.1
+test_duration_seconds_count{route="a\"b\\c\nd"} 1
+# HELP test_events_total События без меток.
+# TYPE test_events_total counter
+test_events_total 0
+# HELP test_requests_total Запросы.
+# TYPE test_requests_total counter
+test_requests_total{method="GET",status="200"} 2
+test_requests_total{method="POST",status="500"} 3
+# HELP test_wait_seconds_total Ожидание.
+# TYPE test_wait_seconds_total counter
+test_wait_seconds_total 1.5
+`
+	if got := b.String(); got != want {
+		t.Errorf("WriteTo:\n%s\nwant:\n%s", got, want)
+	}
+	events.Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_events_total 1\n") {
+		t.Errorf("handler output misses the updated counter:\n%s", rec.Body)
+	}
+}
+
+func TestDuplicateMetric(t *testing.T) {
+	emptyRegistry(t)
+	NewCounterVec("test_duplicate_total", "Первый.")
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a duplicate metric did not panic")
+		}
+	}()
+	NewCounterVec("test_duplicate_total", "Второй.")
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"site/login"
+	"testing"
+)
+
+func TestMetricsHandlerAccess(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string // METRICS_TOKEN
+		auth   string // заголовок Authorization
+		user   *login.Principal
+		status int
+	}{
+		{"guest", "", "", nil, http.StatusForbidden},
+		{"guest without configured token", "", "Bearer ", nil, http.StatusForbidden},
+		{"editor", "", "", &login.Principal{Email: "e@example.com", Role: "editor"}, http.StatusForbidden},
+		{"admin", "", "", &login.Principal{Email: "a@example.com", Role: "admin"}, http.StatusOK},
+		{"token", "s3cret", "Bearer s3cret", nil, http.StatusOK},
+		{"wrong token", "s3cret", "Bearer guess", nil, http.StatusForbidden},
+		{"token not bearer", "s3cret", "s3cret", nil, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("METRICS_TOKEN", tt.token)
+			r := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			r = login.WithPrincipal(r, tt.user)
+			rec := httptest.NewRecorder()
+			metricsHandler(rec, r)
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
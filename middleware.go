@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"site/views"
+)
+
+// requestIDPattern — допустимый X-Request-ID от прокси; остальные заменяются своим
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// withRequestID присваивает запросу номер (из X-Request-ID прокси или новый),
+// кладёт его в контекст и возвращает клиенту в заголовке X-Request-ID
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(views.WithRequestID(r.Context(), id)))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// securityHeaders ставит заголовки защиты на каждый ответ. Политика CSP разрешает скрипты
+// и элементы <style> только свои и с nonce этого ответа (в шаблонах — {{cspNonce}}),
+// стили — ещё с CDN Bootstrap. Атрибуты style="…" запрещены: оформление шаблонов — в css/main.css.
+// Обработчики могут заменить политику своей (см. ServeFileHandler).
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := newNonce()
+		h := w.Header()
+		h.Set("Content-Security-Policy", "default-src 'self'; "+
+			"script-src 'self' 'nonce-"+nonce+"'; "+
+			"style-src 'self' 'nonce-"+nonce+"' https://cdn.jsdelivr.net https://getbootstrap.com; "+
+			"img-src 'self' data: https:; "+
+			"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+		next.ServeHTTP(w, r.WithContext(views.WithNonce(r.Context(), nonce)))
+	})
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// recoverPanics превращает панику обработчика в страницу 500 (или JSON-ошибку для API);
+// стек пишется в лог вместе с номером запроса
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// Обрыв соединения по инициативе net/http — не ошибка
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			err := fmt.Errorf("panic: %v\n%s", v, debug.Stack())
+			if isAPIRequest(r) {
+				writeAPIErr(w, r, err)
+			} else {
+				writeError(w, r, err)
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
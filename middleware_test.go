@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRecoverPanics(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		json   bool
+	}{
+		{"page", "/post/1", http.StatusInternalServerError, false},
+		{"api", "/api/v1/posts", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := withRequestID(recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("secret detail")
+			})))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			if strings.Contains(rec.Body.String(), "secret detail") {
+				t.Errorf("panic value leaked to the client: %s", rec.Body)
+			}
+			isJSON := strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json")
+			if isJSON != tt.json {
+				t.Errorf("Content-Type %q, want JSON = %v", rec.Header().Get("Content-Type"), tt.json)
+			}
+			if tt.json {
+				var body apiError
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error.Status != tt.status {
+					t.Errorf("body %s: %+v, %v", rec.Body, body, err)
+				}
+			}
+		})
+	}
+
+	t.Run("no panic", func(t *testing.T) {
+		h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		if rec.Code != http.StatusTeapot {
+			t.Errorf("status %d, want %d", rec.Code, http.StatusTeapot)
+		}
+	})
+
+	t.Run("abort handler", func(t *testing.T) {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("recovered %v, want http.ErrAbortHandler re-panicked", v)
+			}
+		}()
+		h := recoverPanics(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	})
+}
+
+func TestSecurityHeadersNonce(t *testing.T) {
+	reg, _, err := loadTemplates(embeddedFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := withTemplates(reg, securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// На форме создания поста есть встроенный скрипт предпросмотра Markdown
+		render(w, r, http.StatusOK, "creat", FormData{})
+	})))
+	noncePattern := regexp.MustCompile(`'nonce-([^']+)'`)
+
+	seen := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/creat", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", rec.Code, rec.Body)
+		}
+
+		csp := rec.Header().Get("Content-Security-Policy")
+		if csp == "" {
+			t.Fatal("no Content-Security-Policy header")
+		}
+		if strings.Contains(csp, "unsafe-inline") {
+			t.Errorf("CSP allows inline code: %s", csp)
+		}
+		m := noncePattern.FindAllStringSubmatch(csp, -1)
+		if len(m) == 0 {
+			t.Fatalf("CSP has no nonce: %s", csp)
+		}
+		nonce := m[0][1]
+		for _, other := range m[1:] {
+			if other[1] != nonce {
+				t.Errorf("CSP uses different nonces: %s", csp)
+			}
+		}
+		if seen[nonce] {
+			t.Errorf("nonce %q repeated across requests", nonce)
+		}
+		seen[nonce] = true
+
+		body := rec.Body.String()
+		tags := regexp.MustCompile(`nonce="([^"]*)"`).FindAllStringSubmatch(body, -1)
+		if len(tags) == 0 {
+			t.Fatal("page has no nonce attributes, want the preview script")
+		}
+		for _, tag := range tags {
+			if tag[1] != nonce {
+				t.Errorf("script nonce %q, want the header nonce %q", tag[1], nonce)
+			}
+		}
+		if strings.Contains(body, `style="`) {
+			t.Error("page still has inline style attributes, which the CSP blocks")
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var migrationFS embed.FS
+
+// applyMigrations прогоняет по порядку имён ещё не применённые файлы из migrations/
+func applyMigrations(db *DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    TEXT PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	versions, err := migrationVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", version).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("check %s: %w", version, err)
+		}
+		if exists {
+			continue
+		}
+
+		body, err := migrationFS.ReadFile("migrations/" + version + ".sql")
+		if err != nil {
+			return err
+		}
+
+		// Каждая миграция — в своей транзакции вместе с отметкой о применении
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(body)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("apply %s: %w", version, err)
+		}
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("record %s: %w", version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		slog.Info("migration applied", "job", "migrate", "version", version)
+	}
+	return nil
+}
+
+// migrationVersions — версии встроенных миграций (имена файлов без .sql) по порядку
+func migrationVersions() ([]string, error) {
+	entries, err := migrationFS.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	var versions []string
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), ".sql") {
+			versions = append(versions, strings.TrimSuffix(e.Name(), ".sql"))
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// pendingMigrations — встроенные миграции, которых ещё нет в schema_migrations
+func pendingMigrations(db *DB) ([]string, error) {
+	versions, err := migrationVersions()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[string]bool)
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var pending []string
+	for _, v := range versions {
+		if !applied[v] {
+			pending = append(pending, v)
+		}
+	}
+	return pending, nil
+}
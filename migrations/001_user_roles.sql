@@ -0,0 +1,2 @@
+-- Роли пользователей: user (по умолчанию), editor, admin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';
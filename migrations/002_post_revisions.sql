@@ -0,0 +1,14 @@
+-- История правок статей: каждая строка — снимок поста после сохранения
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id           SERIAL PRIMARY KEY,
+    post_id      INTEGER NOT NULL REFERENCES post(id) ON DELETE CASCADE,
+    title        TEXT NOT NULL,
+    anons        TEXT NOT NULL,
+    full_text    TEXT NOT NULL,
+    photo_id     INTEGER,
+    editor_email TEXT NOT NULL DEFAULT '',
+    note         TEXT NOT NULL DEFAULT '',
+    created_at   TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS post_revisions_post_id_idx ON post_revisions (post_id, id);
@@ -0,0 +1,4 @@
+-- Мягкое удаление статей: удалённые попадают в корзину до очистки
+ALTER TABLE post ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS post_deleted_at_idx ON post (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Кэш HTML, отрендеренного из Markdown-текста статьи; пустая строка — кэш нужно пересчитать
+ALTER TABLE post ADD COLUMN IF NOT EXISTS full_text_html TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Галерея изображений поста; post.photo_id остаётся обложкой (первое изображение галереи)
+CREATE TABLE IF NOT EXISTS post_media (
+    id       SERIAL PRIMARY KEY,
+    post_id  INTEGER NOT NULL REFERENCES post(id) ON DELETE CASCADE,
+    file_id  INTEGER NOT NULL REFERENCES files(id),
+    position INTEGER NOT NULL DEFAULT 0,
+    caption  TEXT NOT NULL DEFAULT '',
+    UNIQUE (post_id, file_id)
+);
+
+CREATE INDEX IF NOT EXISTS post_media_post_id_idx ON post_media (post_id, position);
+
+-- Существующие фото становятся первым элементом галереи
+INSERT INTO post_media (post_id, file_id, position)
+SELECT id, photo_id, 1 FROM post WHERE photo_id IS NOT NULL
+ON CONFLICT (post_id, file_id) DO NOTHING;
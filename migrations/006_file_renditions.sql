@@ -0,0 +1,13 @@
+-- Тип содержимого перекодированного файла; пусто у файлов, загруженных до обработки изображений
+ALTER TABLE files ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT '';
+
+-- Уменьшенные копии изображений (files.data хранит размер "full")
+CREATE TABLE IF NOT EXISTS file_renditions (
+    file_id   INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    size      TEXT NOT NULL,
+    mime_type TEXT NOT NULL,
+    width     INTEGER NOT NULL,
+    height    INTEGER NOT NULL,
+    data      BYTEA NOT NULL,
+    PRIMARY KEY (file_id, size)
+);
@@ -0,0 +1,14 @@
+-- Содержимое файлов переезжает в хранилище блобов (blobstore): в строке остаются ключ и имя бэкенда.
+-- У старых строк blob_key пуст, а данные лежат в data, пока их не перенесёт `site migrate-files`.
+CREATE TABLE IF NOT EXISTS blobs (
+    key  TEXT PRIMARY KEY,
+    data BYTEA NOT NULL
+);
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS blob_key TEXT;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS storage TEXT NOT NULL DEFAULT 'postgres';
+ALTER TABLE files ALTER COLUMN data DROP NOT NULL;
+
+ALTER TABLE file_renditions ADD COLUMN IF NOT EXISTS blob_key TEXT;
+ALTER TABLE file_renditions ADD COLUMN IF NOT EXISTS storage TEXT NOT NULL DEFAULT 'postgres';
+ALTER TABLE file_renditions ALTER COLUMN data DROP NOT NULL;
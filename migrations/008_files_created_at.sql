@@ -0,0 +1,2 @@
+-- Время загрузки файла — Last-Modified при отдаче /file/{id}
+ALTER TABLE files ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
@@ -0,0 +1,16 @@
+-- SHA-256 исходной загрузки: одинаковые файлы переиспользуют уже обработанную строку files
+ALTER TABLE files ADD COLUMN IF NOT EXISTS source_hash TEXT;
+CREATE INDEX IF NOT EXISTS files_source_hash_idx ON files (source_hash);
+CREATE INDEX IF NOT EXISTS files_blob_key_idx ON files (blob_key);
+CREATE INDEX IF NOT EXISTS file_renditions_blob_key_idx ON file_renditions (blob_key);
+
+-- Время последней записи блоба: сборщик мусора не трогает свежие блобы незавершённых загрузок
+ALTER TABLE blobs ADD COLUMN IF NOT EXISTS created_at TIMESTAMP NOT NULL DEFAULT now();
+
+-- Сколько ссылок на каждый файл: обложки постов, ревизии и галереи
+CREATE OR REPLACE VIEW file_ref_counts AS
+SELECT f.id AS file_id,
+       (SELECT count(*) FROM post p WHERE p.photo_id = f.id)
+     + (SELECT count(*) FROM post_revisions r WHERE r.photo_id = f.id)
+     + (SELECT count(*) FROM post_media m WHERE m.file_id = f.id) AS refs
+  FROM files f;
@@ -0,0 +1,12 @@
+-- Персональные API-токены: хранится только SHA-256 токена, сам токен показывается один раз
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           SERIAL PRIMARY KEY,
+    user_email   TEXT NOT NULL,
+    name         TEXT NOT NULL DEFAULT '',
+    token_hash   TEXT NOT NULL UNIQUE,
+    scopes       TEXT[] NOT NULL,
+    created_at   TIMESTAMP NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMP,
+    revoked_at   TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS api_tokens_user_email_idx ON api_tokens (user_email);
@@ -0,0 +1,10 @@
+-- Теги статей: по ним строятся ленты /feed.rss?tag=... и /feed.atom?tag=...
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id INTEGER NOT NULL REFERENCES post(id) ON DELETE CASCADE,
+    tag     TEXT NOT NULL,
+    PRIMARY KEY (post_id, tag)
+);
+CREATE INDEX IF NOT EXISTS post_tags_tag_idx ON post_tags (tag);
+
+-- Размер основного файла в байтах: нужен для <enclosure length> в RSS; у старых файлов NULL
+ALTER TABLE files ADD COLUMN IF NOT EXISTS size BIGINT;
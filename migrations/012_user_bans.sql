@@ -0,0 +1,2 @@
+-- Блокировка пользователей из админки: заблокированный не может войти, его токены отзываются
+ALTER TABLE users ADD COLUMN IF NOT EXISTS banned_at TIMESTAMP;
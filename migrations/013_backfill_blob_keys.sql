@@ -0,0 +1,13 @@
+-- Строки, загруженные до blobstore, переезжают в таблицу blobs: у каждого файла появляется
+-- blob_key, и /file/{id} больше не считает SHA-256 содержимого на каждый запрос
+INSERT INTO blobs (key, data)
+SELECT DISTINCT encode(sha256(data), 'hex'), data FROM files WHERE blob_key IS NULL AND data IS NOT NULL
+ON CONFLICT (key) DO NOTHING;
+UPDATE files SET blob_key = encode(sha256(data), 'hex'), storage = 'postgres', data = NULL
+ WHERE blob_key IS NULL AND data IS NOT NULL;
+
+INSERT INTO blobs (key, data)
+SELECT DISTINCT encode(sha256(data), 'hex'), data FROM file_renditions WHERE blob_key IS NULL AND data IS NOT NULL
+ON CONFLICT (key) DO NOTHING;
+UPDATE file_renditions SET blob_key = encode(sha256(data), 'hex'), storage = 'postgres', data = NULL
+ WHERE blob_key IS NULL AND data IS NOT NULL;
@@ -0,0 +1,6 @@
+-- Alt-текст описывает изображение в контексте конкретного поста: одинаковые загрузки делят
+-- строку files, поэтому alt переезжает из files.description в ссылку post_media
+ALTER TABLE post_media ADD COLUMN IF NOT EXISTS alt TEXT NOT NULL DEFAULT '';
+UPDATE post_media m SET alt = f.description
+  FROM files f
+ WHERE f.id = m.file_id AND m.alt = '' AND f.description IS NOT NULL;
@@ -0,0 +1,10 @@
+-- Колонки TIMESTAMP без пояса хранят время в UTC, а now() приводится к ним в поясе сеанса.
+-- Значения по умолчанию считаем явно в UTC, чтобы строки, вставленные не приложением
+-- (psql, скрипты), не сдвигались на смещение пояса сервера.
+ALTER TABLE post ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE comments ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE post_revisions ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE files ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE blobs ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE api_tokens ALTER COLUMN created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+ALTER TABLE schema_migrations ALTER COLUMN applied_at SET DEFAULT (now() AT TIME ZONE 'UTC');
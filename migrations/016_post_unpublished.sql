@@ -0,0 +1,3 @@
+-- Снятие с публикации из админки: статья пропадает из лент, списков и карты сайта,
+-- но не попадает в корзину и не удаляется
+ALTER TABLE post ADD COLUMN IF NOT EXISTS unpublished_at TIMESTAMP;
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"net/http"
+	"site/login"
+	"strconv"
+	"strings"
+)
+
+// Описание JSON API в формате OpenAPI 3, отдаётся по /api/openapi.json.
+// Каждый маршрут из registerAPIRoutes должен быть описан в apiOperations —
+// это проверяет TestAPIRoutesDocumented.
+
+// apiOperation — одна операция API. Path — относительно /api/v1, в нотации OpenAPI (/posts/{id}).
+type apiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	// Scope — область токена; операции с областью read открыты и гостям
+	Scope string
+	// Query — необязательные целочисленные параметры запроса
+	Query []string
+	// Body — схема JSON-тела (тело больше maxAPIBodyBytes — 413); Multipart — тело multipart/form-data с файлами в поле file
+	Body      string
+	Multipart bool
+	Status    int
+	// Response — схема ответа; пусто для ответа без тела
+	Response string
+	Errors   []int
+}
+
+var apiOperations = []apiOperation{
+	{
+		Method: "GET", Path: "/posts", Summary: "Список статей, новые первыми",
+		Scope: login.ScopeRead, Query: []string{"limit", "offset"},
+		Status: http.StatusOK, Response: "PostList", Errors: []int{400},
+	},
+	{
+		Method: "POST", Path: "/posts", Summary: "Создать статью",
+		Scope: login.ScopeWritePosts, Body: "PostInput",
+		Status: http.StatusCreated, Response: "Post", Errors: []int{400, 401, 403, 413},
+	},
+	{
+		Method: "GET", Path: "/posts/{id}", Summary: "Статья с галереей и отрендеренным текстом",
+		Scope:  login.ScopeRead,
+		Status: http.StatusOK, Response: "Post", Errors: []int{404},
+	},
+	{
+		Method: "PUT", Path: "/posts/{id}", Summary: "Изменить статью и её галерею",
+		Scope: login.ScopeWritePosts, Body: "PostInput",
+		Status: http.StatusOK, Response: "Post", Errors: []int{400, 401, 403, 404, 413},
+	},
+	{
+		Method: "DELETE", Path: "/posts/{id}", Summary: "Перенести статью в корзину",
+		Scope:  login.ScopeWritePosts,
+		Status: http.StatusNoContent, Errors: []int{401, 403, 404},
+	},
+	{
+		Method: "GET", Path: "/posts/{id}/comments", Summary: "Комментарии к статье",
+		Scope:  login.ScopeRead,
+		Status: http.StatusOK, Response: "CommentList", Errors: []int{404},
+	},
+	{
+		Method: "POST", Path: "/posts/{id}/comments", Summary: "Добавить комментарий",
+		Scope: login.ScopeWriteComments, Body: "CommentInput",
+		Status: http.StatusCreated, Response: "Comment", Errors: []int{400, 401, 403, 404, 413},
+	},
+	{
+		Method: "POST", Path: "/files", Summary: "Загрузить изображения для галереи",
+		Scope: login.ScopeWritePosts, Multipart: true,
+		Status: http.StatusCreated, Response: "FileList", Errors: []int{400, 401, 403, 413, 415},
+	},
+}
+
+// apiSchemas — схемы тел запросов и ответов (повторяют api*-типы из api.go)
+var apiSchemas = map[string]any{
+	"Error": object(map[string]any{
+		"error": object(map[string]any{
+			"status":  prop("integer", ""),
+			"message": prop("string", ""),
+		}, "status", "message"),
+	}, "error"),
+	"PostInput": object(map[string]any{
+		"title":        prop("string", ""),
+		"anons":        prop("string", ""),
+		"full_text":    prop("string", "Markdown; изображения галереи — ![подпись](media:N)"),
+		"media":        arrayOf(prop("integer", ""), "id файлов из POST /files: при создании — вся галерея, при правке — добавляются в конец"),
+		"remove_media": arrayOf(prop("integer", ""), "id элементов галереи, которые убрать (только при правке)"),
+		"tags":         arrayOf(prop("string", ""), "при правке заменяют прежние теги"),
+	}, "title"),
+	"Post": object(map[string]any{
+		"id":             prop("integer", ""),
+		"title":          prop("string", ""),
+		"anons":          prop("string", ""),
+		"full_text":      prop("string", "Markdown"),
+		"full_text_html": prop("string", "очищенный HTML"),
+		"cover_url":      prop("string", ""),
+		"media":          arrayOf(ref("Media"), ""),
+		"tags":           arrayOf(prop("string", ""), ""),
+		"url":            prop("string", "адрес HTML-страницы статьи"),
+		"created_at":     dateTime(),
+	}, "id", "title", "anons", "url", "created_at"),
+	"PostList": object(map[string]any{
+		"posts":  arrayOf(ref("Post"), "без full_text, full_text_html, media и tags"),
+		"limit":  prop("integer", ""),
+		"offset": prop("integer", ""),
+	}, "posts", "limit", "offset"),
+	"Media": object(map[string]any{
+		"id":        prop("integer", ""),
+		"file_id":   prop("integer", ""),
+		"position":  prop("integer", ""),
+		"caption":   prop("string", ""),
+		"alt":       prop("string", ""),
+		"url":       prop("string", ""),
+		"thumb_url": prop("string", ""),
+	}, "id", "file_id", "position", "url", "thumb_url"),
+	"CommentInput": object(map[string]any{
+		"content": prop("string", ""),
+	}, "content"),
+	"Comment": object(map[string]any{
+		"id":         prop("integer", ""),
+		"post_id":    prop("integer", ""),
+		"author":     prop("string", "email автора"),
+		"content":    prop("string", ""),
+		"created_at": dateTime(),
+	}, "id", "post_id", "author", "content", "created_at"),
+	"CommentList": object(map[string]any{
+		"comments": arrayOf(ref("Comment"), ""),
+	}, "comments"),
+	"File": object(map[string]any{
+		"id":        prop("integer", ""),
+		"url":       prop("string", ""),
+		"thumb_url": prop("string", ""),
+	}, "id", "url", "thumb_url"),
+	"FileList": object(map[string]any{
+		"files": arrayOf(ref("File"), ""),
+	}, "files"),
+}
+
+func prop(typ, description string) map[string]any {
+	p := map[string]any{"type": typ}
+	if description != "" {
+		p["description"] = description
+	}
+	return p
+}
+
+func dateTime() map[string]any {
+	return map[string]any{"type": "string", "format": "date-time"}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items map[string]any, description string) map[string]any {
+	a := map[string]any{"type": "array", "items": items}
+	if description != "" {
+		a["description"] = description
+	}
+	return a
+}
+
+func object(props map[string]any, required ...string) map[string]any {
+	o := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+	return o
+}
+
+func jsonContent(schema map[string]any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// openAPISpec собирает документ из apiOperations и apiSchemas
+func openAPISpec() map[string]any {
+	paths := map[string]any{}
+	for _, op := range apiOperations {
+		item, _ := paths[op.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+
+		var params []any
+		if strings.Contains(op.Path, "{id}") {
+			params = append(params, map[string]any{
+				"name": "id", "in": "path", "required": true, "schema": prop("integer", ""),
+			})
+		}
+		for _, q := range op.Query {
+			params = append(params, map[string]any{"name": q, "in": "query", "schema": prop("integer", "")})
+		}
+
+		responses := map[string]any{}
+		ok := map[string]any{"description": http.StatusText(op.Status)}
+		if op.Response != "" {
+			ok["content"] = jsonContent(ref(op.Response))
+		}
+		responses[strconv.Itoa(op.Status)] = ok
+		for _, code := range op.Errors {
+			responses[strconv.Itoa(code)] = map[string]any{
+				"description": http.StatusText(code),
+				"content":     jsonContent(ref("Error")),
+			}
+		}
+
+		operation := map[string]any{
+			"summary":     op.Summary,
+			"description": "Область токена: " + op.Scope + ".",
+			"x-scopes":    []string{op.Scope},
+			"operationId": strings.ToLower(op.Method) + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(op.Path),
+			"responses":   responses,
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		switch {
+		case op.Body != "":
+			operation["requestBody"] = map[string]any{"required": true, "content": jsonContent(ref(op.Body))}
+		case op.Multipart:
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content": map[string]any{"multipart/form-data": map[string]any{
+					"schema": object(map[string]any{
+						"file": arrayOf(map[string]any{"type": "string", "format": "binary"}, "JPEG, PNG или GIF"),
+					}, "file"),
+				}},
+			}
+		}
+		// Записи нужна сессия или токен с областью Scope; читать можно и без авторизации.
+		// Список областей в требовании допустим только для oauth2 и openIdConnect, поэтому у схемы
+		// http bearer он пуст, а нужная область указана в description и x-scopes.
+		security := []any{
+			map[string]any{"bearerAuth": []string{}},
+			map[string]any{"cookieAuth": []string{}},
+		}
+		if op.Scope == login.ScopeRead {
+			security = append([]any{map[string]any{}}, security...)
+		}
+		operation["security"] = security
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "Новостной сайт — API",
+			"version": "1",
+		},
+		"servers": []any{map[string]any{"url": "/api/v1"}},
+		"paths":   paths,
+		"components": map[string]any{
+			"schemas": apiSchemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "Персональный токен со страницы /account; области: " + strings.Join(login.Scopes, ", "),
+				},
+				"cookieAuth": map[string]any{"type": "apiKey", "in": "cookie", "name": "session-name"},
+			},
+		},
+	}
+}
+
+// openAPIHandler — GET /api/openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, openAPISpec())
+}
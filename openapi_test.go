@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// routeVar — переменная пути mux с регулярным выражением: {id:[0-9]+} → {id}
+var routeVar = regexp.MustCompile(`\{([^}:]+):[^}]*\}`)
+
+// apiRoutes — операции JSON API, зарегистрированные в роутере, как "METHOD /path" относительно /api/v1
+func apiRoutes(t *testing.T, rtr *mux.Router) map[string]bool {
+	t.Helper()
+	routes := map[string]bool{}
+	err := rtr.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		tpl, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path, ok := strings.CutPrefix(tpl, "/api/v1")
+		if !ok || path == "" {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("маршрут API %s без метода", tpl)
+			return nil
+		}
+		for _, m := range methods {
+			routes[m+" "+routeVar.ReplaceAllString(path, "{$1}")] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return routes
+}
+
+func TestAPIRoutesDocumented(t *testing.T) {
+	routes := apiRoutes(t, newRouter(nil, nil, nil))
+	if len(routes) == 0 {
+		t.Fatal("в роутере нет маршрутов /api/v1")
+	}
+
+	documented := map[string]bool{}
+	for _, op := range apiOperations {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	for r := range routes {
+		if !documented[r] {
+			t.Errorf("маршрут %s не описан в apiOperations (openapi.go)", r)
+		}
+	}
+	for d := range documented {
+		if !routes[d] {
+			t.Errorf("операция %s описана, но не зарегистрирована в registerAPIRoutes", d)
+		}
+	}
+}
+
+func TestOpenAPISchemaRefs(t *testing.T) {
+	data, err := json.Marshal(openAPISpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range regexp.MustCompile(`"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(data), -1) {
+		if _, ok := apiSchemas[m[1]]; !ok {
+			t.Errorf("ссылка на неописанную схему %s", m[1])
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newRouter(nil, nil, nil).ServeHTTP(rec, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json: %d", rec.Code)
+	}
+	var spec struct {
+		OpenAPI string         `json:"openapi"`
+		Paths   map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") || len(spec.Paths) == 0 {
+		t.Errorf("неожиданный документ: openapi=%q, paths=%d", spec.OpenAPI, len(spec.Paths))
+	}
+}
+
+func TestOpenAPISecurityAndErrors(t *testing.T) {
+	data, err := json.Marshal(openAPISpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Security    []map[string][]string `json:"security"`
+			Scopes      []string              `json:"x-scopes"`
+			Description string                `json:"description"`
+			RequestBody *struct {
+				Content map[string]any `json:"content"`
+			} `json:"requestBody"`
+			Responses map[string]any `json:"responses"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, op := range apiOperations {
+		o, ok := spec.Paths[op.Path][strings.ToLower(op.Method)]
+		if !ok {
+			t.Errorf("операция %s %s отсутствует в документе", op.Method, op.Path)
+			continue
+		}
+		// У схем, кроме oauth2 и openIdConnect, список областей в требовании обязан быть пустым
+		for _, req := range o.Security {
+			for scheme, scopes := range req {
+				if len(scopes) != 0 {
+					t.Errorf("%s %s: у схемы %s области %v, для схемы не oauth2 список должен быть пустым", op.Method, op.Path, scheme, scopes)
+				}
+			}
+		}
+		if len(o.Scopes) != 1 || o.Scopes[0] != op.Scope || !strings.Contains(o.Description, op.Scope) {
+			t.Errorf("%s %s: x-scopes %v, description %q, ожидалась область %s", op.Method, op.Path, o.Scopes, o.Description, op.Scope)
+		}
+		if o.RequestBody != nil && o.RequestBody.Content["application/json"] != nil && o.Responses["413"] == nil {
+			t.Errorf("%s %s принимает JSON-тело, но не описывает ответ 413", op.Method, op.Path)
+		}
+	}
+}
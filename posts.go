@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"site/login"
+	"site/views"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Общие операции над статьями и комментариями: их вызывают и HTML-формы (main.go), и JSON API (api.go)
+
+// maxTitleRunes — предел длины заголовка статьи
+const maxTitleRunes = 300
+
+// Пределы для тегов статьи
+const (
+	maxTags     = 10
+	maxTagRunes = 40
+)
+
+// InputError — ошибка проверки введённых данных; текст показывается пользователю как есть
+type InputError struct {
+	Message string
+}
+
+func (e *InputError) Error() string { return e.Message }
+
+func (e *InputError) HTTPStatus() int { return http.StatusBadRequest }
+
+// PostInput — поля статьи из формы или из тела запроса API
+type PostInput struct {
+	Title    string   `json:"title"`
+	Anons    string   `json:"anons"`
+	FullText string   `json:"full_text"`
+	Tags     []string `json:"tags"`
+}
+
+// validate проверяет заголовок и приводит теги к нижнему регистру без повторов. Правила те же,
+// что были у HTML-форм: анонс и текст статьи могут быть пустыми.
+func (in *PostInput) validate() error {
+	tags, err := normalizeTags(in.Tags)
+	if err != nil {
+		return err
+	}
+	in.Tags = tags
+
+	switch {
+	case strings.TrimSpace(in.Title) == "":
+		return &InputError{Message: "Заголовок обязателен"}
+	case utf8.RuneCountInString(in.Title) > maxTitleRunes:
+		return &InputError{Message: "Заголовок длиннее допустимого"}
+	}
+	return nil
+}
+
+// parseTags разбирает теги из поля формы, через запятую
+func parseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// normalizeTags — теги в нижнем регистре, без пробелов по краям и повторов;
+// допустимы буквы, цифры, дефис, подчёркивание и пробел
+func normalizeTags(tags []string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if utf8.RuneCountInString(t) > maxTagRunes {
+			return nil, &InputError{Message: fmt.Sprintf("Тег %q длиннее %d символов", t, maxTagRunes)}
+		}
+		for _, r := range t {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != ' ' {
+				return nil, &InputError{Message: fmt.Sprintf("Недопустимый символ в теге %q", t)}
+			}
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	if len(out) > maxTags {
+		return nil, &InputError{Message: fmt.Sprintf("Не больше %d тегов", maxTags)}
+	}
+	return out, nil
+}
+
+// setPostTags заменяет теги статьи
+func setPostTags(db execer, postID int, tags []string) error {
+	if _, err := db.Exec("DELETE FROM post_tags WHERE post_id = $1", postID); err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if _, err := db.Exec("INSERT INTO post_tags (post_id, tag) VALUES ($1, $2)", postID, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPostTags возвращает теги статьи по алфавиту
+func loadPostTags(db queryer, postID int) ([]string, error) {
+	rows, err := db.Query("SELECT tag FROM post_tags WHERE post_id = $1 ORDER BY tag", postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// createPost сохраняет новую статью с галереей из fileIDs (первый файл — обложка)
+// и записывает первую ревизию в историю правок
+func createPost(db *DB, in PostInput, fileIDs []int, author string) (int, error) {
+	if err := in.validate(); err != nil {
+		return 0, err
+	}
+
+	media := make([]Media, len(fileIDs))
+	for i, fid := range fileIDs {
+		media[i] = Media{FileID: fid, Position: i + 1}
+	}
+	var photoID sql.NullInt64
+	if len(fileIDs) > 0 {
+		photoID = sql.NullInt64{Int64: int64(fileIDs[0]), Valid: true}
+	}
+
+	fullTextHTML, err := renderMarkdown(in.FullText, media)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var postID int
+	err = tx.QueryRow(
+		`INSERT INTO post (title, anons, full_text, full_text_html, photo_id)
+         VALUES ($1, $2, $3, $4, $5)
+         RETURNING id`,
+		in.Title, in.Anons, in.FullText, string(fullTextHTML), photoID,
+	).Scan(&postID)
+	if err != nil {
+		return 0, err
+	}
+	if err := appendPostMedia(tx, postID, fileIDs); err != nil {
+		return 0, err
+	}
+	if err := setPostTags(tx, postID, in.Tags); err != nil {
+		return 0, err
+	}
+	if err := recordRevision(tx, postID, author, "создание"); err != nil {
+		return 0, err
+	}
+	return postID, tx.Commit()
+}
+
+// updatePost сохраняет правку статьи: поля, изменения галереи (см. applyMediaEdits),
+// новые файлы в конец галереи, ревизию в истории. Для удалённого поста — sql.ErrNoRows.
+func updatePost(db *DB, id int, in PostInput, edits url.Values, fileIDs []int, author string) error {
+	if err := in.validate(); err != nil {
+		return err
+	}
+
+	// Пост, галерея и ревизия сохраняются вместе
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Блокируем строку, чтобы пост не ушёл в корзину посреди правки
+	var exists bool
+	err = tx.QueryRow("SELECT true FROM post WHERE id = $1 AND deleted_at IS NULL FOR UPDATE", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	// Посты, созданные до истории правок, сначала получают исходную ревизию
+	if err := ensureBaselineRevision(tx, id); err != nil {
+		return err
+	}
+
+	// Удаление, порядок, подписи; затем обложка = первое изображение
+	if err := applyMediaEdits(tx, edits, id); err != nil {
+		return err
+	}
+	if err := appendPostMedia(tx, id, fileIDs); err != nil {
+		return err
+	}
+	if err := normalizeMedia(tx, id); err != nil {
+		return err
+	}
+
+	media, err := loadPostMedia(tx, id)
+	if err != nil {
+		return err
+	}
+	fullTextHTML, err := renderMarkdown(in.FullText, media)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`UPDATE post
+         SET title = $1, anons = $2, full_text = $3, full_text_html = $4
+         WHERE id = $5`,
+		in.Title, in.Anons, in.FullText, string(fullTextHTML), id,
+	)
+	if err != nil {
+		return err
+	}
+	if err := setPostTags(tx, id, in.Tags); err != nil {
+		return err
+	}
+	if err := recordRevision(tx, id, author, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// trashPost переносит пост в корзину; окончательно он удаляется из неё (см. trash.go).
+// Возвращает false, если поста нет или он уже в корзине.
+func trashPost(db *DB, id int) (bool, error) {
+	res, err := db.Exec("UPDATE post SET deleted_at = now() WHERE id = $1 AND deleted_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// checkPostEditor проверяет, что текущий пользователь может править и удалять статью id:
+// это её автор (автор ревизии «создание») или редактор. У статей, созданных до истории
+// правок, автор неизвестен — их правят только редакторы. Статьи нет или она в корзине —
+// sql.ErrNoRows, гость — 401, чужая статья — 403.
+func checkPostEditor(db *DB, r *http.Request, id int) error {
+	p := login.CurrentPrincipal(r)
+	if p == nil {
+		return views.Unauthorized("Нужно войти")
+	}
+	var author string
+	err := db.QueryRow(
+		`SELECT COALESCE((SELECT r.editor_email FROM post_revisions r WHERE r.post_id = p.id ORDER BY r.id LIMIT 1), '')
+           FROM post p WHERE p.id = $1 AND p.deleted_at IS NULL`,
+		id,
+	).Scan(&author)
+	if err != nil {
+		return err
+	}
+	if !p.IsEditor() && (author == "" || !strings.EqualFold(author, p.Email)) {
+		return views.Forbidden("Править статью могут только её автор и редакторы")
+	}
+	return nil
+}
+
+// loadPost читает статью вместе с отрендеренным текстом; для удалённой — sql.ErrNoRows,
+// для снятой с публикации — тоже, если не withUnpublished
+func loadPost(db *DB, id int, withUnpublished bool) (Post, error) {
+	var p Post
+	err := db.QueryRow(
+		`SELECT id, title, anons, full_text, full_text_html, photo_id, created_at FROM post
+          WHERE id = $1 AND deleted_at IS NULL AND (unpublished_at IS NULL OR $2)`,
+		id, withUnpublished,
+	).Scan(&p.Id, &p.Title, &p.Anons, &p.Full_text, (*string)(&p.FullTextHTML), &p.PhotoID, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+	if p.Tags, err = loadPostTags(db, id); err != nil {
+		return p, err
+	}
+	return p, ensureRenderedHTML(db, &p)
+}
+
+// addComment сохраняет комментарий; статьи из корзины комментировать нельзя (sql.ErrNoRows)
+func addComment(db *DB, postID int, userEmail, content string) (Comment, error) {
+	c := Comment{PostID: postID, UserEmail: userEmail, Content: content}
+	if strings.TrimSpace(content) == "" {
+		return c, &InputError{Message: "Комментарий не может быть пустым"}
+	}
+	err := db.QueryRow(
+		`INSERT INTO comments (post_id, user_email, content)
+         SELECT $1, $2, $3 WHERE EXISTS (SELECT 1 FROM post WHERE id = $1 AND deleted_at IS NULL)
+         RETURNING id, created_at`,
+		postID, userEmail, content,
+	).Scan(&c.Id, &c.CreatedAt)
+	return c, err
+}
+
+// loadComments возвращает комментарии к статье в порядке добавления
+func loadComments(db *DB, postID int) ([]Comment, error) {
+	rows, err := db.Query(
+		"SELECT id, post_id, user_email, content, created_at FROM comments WHERE post_id = $1 ORDER BY created_at ASC",
+		postID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.Id, &c.PostID, &c.UserEmail, &c.Content, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"site/login"
+	"site/views"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type Revision struct {
+	Id          int
+	PostID      int
+	Title       string
+	Anons       string
+	Full_text   string
+	PhotoID     sql.NullInt64
+	EditorEmail string
+	Note        string
+	CreatedAt   time.Time
+}
+
+// RevisionView — ревизия вместе с пословным diff относительно предыдущей
+type RevisionView struct {
+	Revision
+	TitleDiff    []DiffPart
+	AnonsDiff    []DiffPart
+	FullTextDiff []DiffPart
+	PhotoChanged bool
+}
+
+type HistoryData struct {
+	Post            Post
+	Revisions       []RevisionView
+	IsAuthenticated bool
+	IsEditor        bool
+}
+
+// execer — общий интерфейс *sql.DB и *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// recordRevision сохраняет текущее состояние поста как новую ревизию
+func recordRevision(db execer, postID int, editorEmail, note string) error {
+	_, err := db.Exec(
+		`INSERT INTO post_revisions (post_id, title, anons, full_text, photo_id, editor_email, note)
+         SELECT id, title, anons, full_text, photo_id, $2, $3 FROM post WHERE id = $1`,
+		postID, editorEmail, note,
+	)
+	return err
+}
+
+// ensureBaselineRevision сохраняет исходную версию поста, созданного до появления истории правок
+func ensureBaselineRevision(db execer, postID int) error {
+	_, err := db.Exec(
+		`INSERT INTO post_revisions (post_id, title, anons, full_text, photo_id, note, created_at)
+         SELECT id, title, anons, full_text, photo_id, 'исходная версия', created_at FROM post
+          WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM post_revisions WHERE post_id = $1)`,
+		postID,
+	)
+	return err
+}
+
+// historyHandler — GET /post/{id}/history, список ревизий с пословными изменениями
+func historyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, views.BadRequest("Некорректный ID"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	var p Post
+	err = db.QueryRow(
+		"SELECT id, title, anons, full_text, photo_id, created_at FROM post WHERE id = $1 AND deleted_at IS NULL",
+		id,
+	).Scan(&p.Id, &p.Title, &p.Anons, &p.Full_text, &p.PhotoID, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		writeError(w, r, views.NotFound("Статья не найдена"))
+		return
+	} else if err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения из БД", err))
+		return
+	}
+
+	rows, err := db.Query(
+		`SELECT id, post_id, title, anons, full_text, photo_id, editor_email, note, created_at
+           FROM post_revisions WHERE post_id = $1 ORDER BY id ASC`,
+		id,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения истории", err))
+		return
+	}
+	defer rows.Close()
+
+	var revs []Revision
+	for rows.Next() {
+		var rv Revision
+		if err := rows.Scan(&rv.Id, &rv.PostID, &rv.Title, &rv.Anons, &rv.Full_text,
+			&rv.PhotoID, &rv.EditorEmail, &rv.Note, &rv.CreatedAt); err != nil {
+			writeError(w, r, views.Internal("Ошибка сканирования ревизии", err))
+			return
+		}
+		revs = append(revs, rv)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, views.Internal("Ошибка после обхода ревизий", err))
+		return
+	}
+
+	// Новые ревизии сверху, каждая сравнивается с предыдущей по времени
+	views := make([]RevisionView, 0, len(revs))
+	for i := len(revs) - 1; i >= 0; i-- {
+		var prev Revision
+		if i > 0 {
+			prev = revs[i-1]
+		}
+		cur := revs[i]
+		views = append(views, RevisionView{
+			Revision:     cur,
+			TitleDiff:    diffWords(prev.Title, cur.Title),
+			AnonsDiff:    diffWords(prev.Anons, cur.Anons),
+			FullTextDiff: diffWords(prev.Full_text, cur.Full_text),
+			PhotoChanged: i > 0 && prev.PhotoID != cur.PhotoID,
+		})
+	}
+
+	data := HistoryData{
+		Post:            p,
+		Revisions:       views,
+		IsAuthenticated: login.IsAuthenticated(r),
+		IsEditor:        login.IsEditor(r),
+	}
+	render(w, r, http.StatusOK, "history", data)
+}
+
+// restoreRevisionHandler — POST /post/{id}/history/{rev}/restore, откат к выбранной ревизии (только для редакторов)
+func restoreRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	if !login.IsEditor(r) {
+		writeError(w, r, views.Forbidden("Откатывать правки могут только редакторы"))
+		return
+	}
+
+	vars := mux.Vars(r)
+	postID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeError(w, r, views.BadRequest("Некорректный ID"))
+		return
+	}
+	revID, err := strconv.Atoi(vars["rev"])
+	if err != nil {
+		writeError(w, r, views.BadRequest("Некорректный ID ревизии"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка начала транзакции", err))
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE post p
+            SET title = r.title, anons = r.anons, full_text = r.full_text, full_text_html = '', photo_id = r.photo_id
+           FROM post_revisions r
+          WHERE r.id = $1 AND r.post_id = $2 AND p.id = r.post_id AND p.deleted_at IS NULL`,
+		revID, postID,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка отката", err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, r, views.NotFound("Ревизия не найдена"))
+		return
+	}
+
+	// Обложка ревизии возвращается в начало галереи
+	if err := promoteCover(tx, postID); err != nil {
+		writeError(w, r, views.Internal("Ошибка обновления галереи", err))
+		return
+	}
+
+	note := fmt.Sprintf("откат к ревизии #%d", revID)
+	if err := recordRevision(tx, postID, login.UserEmail(r), note); err != nil {
+		writeError(w, r, views.Internal("Ошибка сохранения ревизии", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(w, r, views.Internal("Ошибка фиксации транзакции", err))
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/%d/history", postID), http.StatusSeeOther)
+}
+
+// DiffPart — кусок текста в diff: Op равен "=", "+" или "-"
+type DiffPart struct {
+	Op   string
+	Text string
+}
+
+// maxDiffCells ограничивает размер таблицы LCS, чтобы огромные тексты не съели память
+const maxDiffCells = 4_000_000
+
+// diffWords строит пословный diff между a и b (LCS по словам)
+func diffWords(a, b string) []DiffPart {
+	aw, bw := strings.Fields(a), strings.Fields(b)
+
+	// Общие начало и конец не участвуют в LCS
+	pre := 0
+	for pre < len(aw) && pre < len(bw) && aw[pre] == bw[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(aw)-pre && suf < len(bw)-pre && aw[len(aw)-1-suf] == bw[len(bw)-1-suf] {
+		suf++
+	}
+
+	var parts []DiffPart
+	add := func(op, word string) {
+		if n := len(parts); n > 0 && parts[n-1].Op == op {
+			parts[n-1].Text += " " + word
+			return
+		}
+		parts = append(parts, DiffPart{Op: op, Text: word})
+	}
+
+	for _, w := range aw[:pre] {
+		add("=", w)
+	}
+
+	am, bm := aw[pre:len(aw)-suf], bw[pre:len(bw)-suf]
+	if (len(am)+1)*(len(bm)+1) > maxDiffCells {
+		// Слишком большой участок — показываем его как полную замену
+		for _, w := range am {
+			add("-", w)
+		}
+		for _, w := range bm {
+			add("+", w)
+		}
+	} else {
+		// lcs[i][j] — длина LCS для am[i:] и bm[j:]
+		cols := len(bm) + 1
+		lcs := make([]int32, (len(am)+1)*cols)
+		for i := len(am) - 1; i >= 0; i-- {
+			for j := len(bm) - 1; j >= 0; j-- {
+				if am[i] == bm[j] {
+					lcs[i*cols+j] = lcs[(i+1)*cols+j+1] + 1
+				} else {
+					lcs[i*cols+j] = max(lcs[(i+1)*cols+j], lcs[i*cols+j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < len(am) && j < len(bm) {
+			switch {
+			case am[i] == bm[j]:
+				add("=", am[i])
+				i++
+				j++
+			case lcs[(i+1)*cols+j] >= lcs[i*cols+j+1]:
+				add("-", am[i])
+				i++
+			default:
+				add("+", bm[j])
+				j++
+			}
+		}
+		for ; i < len(am); i++ {
+			add("-", am[i])
+		}
+		for ; j < len(bm); j++ {
+			add("+", bm[j])
+		}
+	}
+
+	for _, w := range aw[len(aw)-suf:] {
+		add("=", w)
+	}
+	return parts
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffPart
+	}{
+		{"равны", "один два три", "один два три", []DiffPart{{"=", "один два три"}}},
+		{"оба пустые", "", "", nil},
+		{"из пустого", "", "новый текст", []DiffPart{{"+", "новый текст"}}},
+		{"в пустой", "старый текст", "", []DiffPart{{"-", "старый текст"}}},
+		{"замена в середине", "один два три", "один пять три",
+			[]DiffPart{{"=", "один"}, {"-", "два"}, {"+", "пять"}, {"=", "три"}}},
+		{"вставка", "a c", "a b c", []DiffPart{{"=", "a"}, {"+", "b"}, {"=", "c"}}},
+		{"удаление в конце", "a b c", "a b", []DiffPart{{"=", "a b"}, {"-", "c"}}},
+		{"пробелы не важны", "a  b\n c", "a b c", []DiffPart{{"=", "a b c"}}},
+		{"LCS внутри", "x a b y", "z a b w",
+			[]DiffPart{{"-", "x"}, {"+", "z"}, {"=", "a b"}, {"-", "y"}, {"+", "w"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffWords(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffWords(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// Слишком большой изменённый участок показывается как полная замена, без таблицы LCS
+func TestDiffWordsLarge(t *testing.T) {
+	a := strings.Repeat("a ", 3000)
+	b := strings.Repeat("b ", 3000)
+	got := diffWords("start "+a+"end", "start "+b+"end")
+	if len(got) != 4 || got[0] != (DiffPart{"=", "start"}) || got[1].Op != "-" || got[2].Op != "+" || got[3] != (DiffPart{"=", "end"}) {
+		t.Fatalf("unexpected diff shape: %d parts", len(got))
+	}
+	if got[1].Text != strings.TrimSpace(a) || got[2].Text != strings.TrimSpace(b) {
+		t.Error("replacement text mismatch")
+	}
+}
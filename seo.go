@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"site/views"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// sitemapPageSize — адресов в одном файле карты сайта (протокол допускает до 50 000)
+const sitemapPageSize = 10000
+
+// postUpdatedAtSQL — время последней правки статьи p: создание или последняя ревизия
+const postUpdatedAtSQL = `GREATEST(p.created_at, COALESCE((SELECT MAX(r.created_at) FROM post_revisions r WHERE r.post_id = p.id), p.created_at))`
+
+// PageMeta — метаданные страницы для header.html: canonical, OpenGraph и Twitter Card
+type PageMeta struct {
+	Title       string
+	Description string
+	// URL — канонический абсолютный адрес страницы
+	URL string
+	// Image — абсолютный адрес картинки для превью; пусто — без картинки
+	Image string
+	// Type — og:type: "website" или "article"
+	Type string
+}
+
+// pageMeta — метаданные обычной страницы; канонический адрес — путь запроса без параметров
+func pageMeta(r *http.Request, title, description string) *PageMeta {
+	return &PageMeta{
+		Title:       title,
+		Description: description,
+		URL:         siteURL(r) + r.URL.Path,
+		Type:        "website",
+	}
+}
+
+// postMeta — метаданные страницы статьи: заголовок, анонс и обложка
+func postMeta(r *http.Request, p Post, media []Media) *PageMeta {
+	base := siteURL(r)
+	m := &PageMeta{
+		Title:       p.Title,
+		Description: truncateRunes(p.Anons, 200),
+		URL:         fmt.Sprintf("%s/post/%d", base, p.Id),
+		Type:        "article",
+	}
+	if len(media) > 0 {
+		m.Image = base + media[0].URL("medium")
+	} else if p.PhotoID.Valid {
+		m.Image = base + Media{FileID: int(p.PhotoID.Int64)}.URL("medium")
+	}
+	return m
+}
+
+// truncateRunes обрезает строку до n символов по границе слова
+func truncateRunes(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	cut := string([]rune(s)[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapRef `xml:"sitemap"`
+}
+
+type sitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func writeXML(w http.ResponseWriter, r *http.Request, v any) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		writeError(w, r, views.Internal("Error encoding XML", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// sitemapPage — номер файла карты сайта для статьи: страница n содержит id
+// от (n-1)*sitemapPageSize+1 до n*sitemapPageSize, так что адрес не переезжает между файлами
+// и страница выбирается по первичному ключу без нумерации всех статей
+func sitemapPage(id int) int {
+	return (id-1)/sitemapPageSize + 1
+}
+
+// sitemapIndexHandler — GET /sitemap.xml: индекс непустых страниц /sitemap-N.xml; первая есть всегда
+func sitemapIndexHandler(w http.ResponseWriter, r *http.Request) {
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Error connecting to the database", err))
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(
+		`SELECT (p.id - 1) / $1 + 1 AS page, MAX(`+postUpdatedAtSQL+`)
+           FROM post p WHERE p.deleted_at IS NULL AND p.unpublished_at IS NULL
+          GROUP BY page
+          ORDER BY page`,
+		sitemapPageSize,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Error querying the database", err))
+		return
+	}
+	defer rows.Close()
+
+	base := siteURL(r)
+	var index sitemapIndex
+	for rows.Next() {
+		var page int
+		var updated time.Time
+		if err := rows.Scan(&page, &updated); err != nil {
+			writeError(w, r, views.Internal("Error scanning post", err))
+			return
+		}
+		if page > 1 && len(index.Sitemaps) == 0 {
+			index.Sitemaps = append(index.Sitemaps, sitemapRef{Loc: base + "/sitemap-1.xml"})
+		}
+		index.Sitemaps = append(index.Sitemaps, sitemapRef{
+			Loc:     fmt.Sprintf("%s/sitemap-%d.xml", base, page),
+			LastMod: updated.UTC().Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, views.Internal("Error querying the database", err))
+		return
+	}
+	if len(index.Sitemaps) == 0 {
+		index.Sitemaps = append(index.Sitemaps, sitemapRef{Loc: base + "/sitemap-1.xml"})
+	}
+	writeXML(w, r, index)
+}
+
+// sitemapPageHandler — GET /sitemap-{n}.xml: статьи n-й страницы (см. sitemapPage); первая включает и главную
+func sitemapPageHandler(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(mux.Vars(r)["n"])
+	if err != nil || page < 1 || page > sitemapPage(math.MaxInt32) {
+		writeError(w, r, views.NotFound("Страница не найдена"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Error connecting to the database", err))
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(
+		`SELECT p.id, `+postUpdatedAtSQL+`
+           FROM post p
+          WHERE p.deleted_at IS NULL AND p.unpublished_at IS NULL AND p.id > $1 AND p.id <= $2
+          ORDER BY p.id`,
+		(page-1)*sitemapPageSize, page*sitemapPageSize,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Error querying the database", err))
+		return
+	}
+	defer rows.Close()
+
+	base := siteURL(r)
+	var set urlSet
+	if page == 1 {
+		set.URLs = append(set.URLs, sitemapURL{Loc: base + "/"}, sitemapURL{Loc: base + "/today"})
+	}
+	for rows.Next() {
+		var id int
+		var updated time.Time
+		if err := rows.Scan(&id, &updated); err != nil {
+			writeError(w, r, views.Internal("Error scanning post", err))
+			return
+		}
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     fmt.Sprintf("%s/post/%d", base, id),
+			LastMod: updated.UTC().Format(time.RFC3339),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, views.Internal("Error querying the database", err))
+		return
+	}
+	if len(set.URLs) == 0 {
+		writeError(w, r, views.NotFound("Страница не найдена"))
+		return
+	}
+	writeXML(w, r, set)
+}
+
+// robotsHandler — GET /robots.txt: закрываем служебные страницы и указываем карту сайта
+func robotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, `User-agent: *
+Disallow: /creat
+Disallow: /post/edit/
+Disallow: /trash
+Disallow: /account
+Disallow: /api/
+Disallow: /markdown/
+Disallow: /metrics
+Disallow: /admin
+
+Sitemap: %s/sitemap.xml
+`, siteURL(r))
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"site/login"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// shuttingDown поднимается, когда сервер начал останавливаться: /readyz с этого момента
+// отвечает 503, и балансировщик перестаёт слать новые запросы, пока текущие дорабатывают
+var shuttingDown atomic.Bool
+
+// serverTimeouts — таймауты HTTP-сервера. Переопределяются переменными окружения
+// в формате time.ParseDuration: HTTP_READ_HEADER_TIMEOUT, HTTP_READ_TIMEOUT,
+// HTTP_WRITE_TIMEOUT, HTTP_IDLE_TIMEOUT, HTTP_SHUTDOWN_TIMEOUT.
+type serverTimeouts struct {
+	ReadHeader time.Duration
+	Read       time.Duration // запас на загрузку файлов до UPLOAD_MAX_REQUEST_BYTES
+	Write      time.Duration
+	Idle       time.Duration
+	Shutdown   time.Duration // сколько ждать текущие запросы при остановке
+}
+
+func loadServerTimeouts() serverTimeouts {
+	return serverTimeouts{
+		ReadHeader: envDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		Read:       envDuration("HTTP_READ_TIMEOUT", 2*time.Minute),
+		Write:      envDuration("HTTP_WRITE_TIMEOUT", 2*time.Minute),
+		Idle:       envDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		Shutdown:   envDuration("HTTP_SHUTDOWN_TIMEOUT", 30*time.Second),
+	}
+}
+
+func envDuration(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		slog.Warn("invalid duration setting, using default", "name", name, "value", v, "default", def)
+	}
+	return def
+}
+
+// listenConfig — адреса и сертификат. HTTP_ADDR (по умолчанию :8080) — обычный HTTP.
+// Если заданы TLS_CERT_FILE и TLS_KEY_FILE, сайт обслуживается по HTTPS на HTTPS_ADDR
+// (по умолчанию :8443), а HTTP_ADDR только перенаправляет на HTTPS. Обновлённые на диске
+// файлы сертификата подхватываются без перезапуска (см. certReloader).
+//
+// Вместо файлов можно задать TLS_AUTOCERT_DOMAINS — домены через запятую: сертификаты для них
+// выпускаются и продлеваются через Let's Encrypt (ACME) и хранятся в TLS_AUTOCERT_CACHE
+// (по умолчанию autocert-cache). Удостоверяющий центр проверяет домен запросом на порты 80 и 443,
+// поэтому HTTP_ADDR и HTTPS_ADDR должны быть доступны снаружи на этих портах.
+type listenConfig struct {
+	HTTPAddr, HTTPSAddr string
+	CertFile, KeyFile   string
+	AutocertDomains     []string
+	AutocertCache       string
+	HSTSMaxAge          int // секунды, HSTS_MAX_AGE, по умолчанию год
+}
+
+func (c listenConfig) TLS() bool { return c.CertFile != "" || c.Autocert() }
+
+// Autocert — сертификаты выпускаются автоматически, а не читаются из файлов
+func (c listenConfig) Autocert() bool { return len(c.AutocertDomains) > 0 }
+
+func loadListenConfig() (listenConfig, error) {
+	c := listenConfig{
+		HTTPAddr:   os.Getenv("HTTP_ADDR"),
+		HTTPSAddr:  os.Getenv("HTTPS_ADDR"),
+		CertFile:   os.Getenv("TLS_CERT_FILE"),
+		KeyFile:    os.Getenv("TLS_KEY_FILE"),
+		HSTSMaxAge: envInt("HSTS_MAX_AGE", 365*24*60*60),
+	}
+	for _, d := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			c.AutocertDomains = append(c.AutocertDomains, d)
+		}
+	}
+	c.AutocertCache = os.Getenv("TLS_AUTOCERT_CACHE")
+	if c.AutocertCache == "" {
+		c.AutocertCache = "autocert-cache"
+	}
+	if c.HTTPAddr == "" {
+		c.HTTPAddr = ":8080"
+	}
+	if c.HTTPSAddr == "" {
+		c.HTTPSAddr = ":8443"
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return c, errors.New("TLS_CERT_FILE и TLS_KEY_FILE задаются вместе")
+	}
+	if c.CertFile != "" && c.Autocert() {
+		return c, errors.New("TLS_AUTOCERT_DOMAINS нельзя задать вместе с TLS_CERT_FILE и TLS_KEY_FILE")
+	}
+	return c, nil
+}
+
+// tlsSetup готовит настройки HTTPS и обработчик HTTP-порта. С файлами сертификата
+// HTTP-порт только перенаправляет на HTTPS; с autocert он ещё отвечает на проверки ACME.
+func tlsSetup(c listenConfig) (*tls.Config, http.Handler, error) {
+	redirect := redirectToHTTPS(c.HTTPSAddr)
+	if c.Autocert() {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(c.AutocertDomains...),
+			Cache:      autocert.DirCache(c.AutocertCache),
+		}
+		cfg := m.TLSConfig()
+		cfg.MinVersion = tls.VersionTLS12
+		return cfg, m.HTTPHandler(redirect), nil
+	}
+
+	// Сертификат читаем заранее, чтобы ошибка в путях не всплыла только в горутине
+	certs := &certReloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if _, err := certs.GetCertificate(nil); err != nil {
+		return nil, nil, err
+	}
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certs.GetCertificate}, redirect, nil
+}
+
+// certReloader отдаёт сертификат из файлов и перечитывает их, когда они меняются:
+// продлённый certbot или cert-manager сертификат подхватывается без перезапуска
+type certReloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var latest time.Time
+	for _, name := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && latest.Equal(c.modTime) {
+		return c.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		if c.cert != nil {
+			// Файлы переписываются прямо сейчас — пока отдаём прежний сертификат
+			slog.Warn("reloading tls certificate failed", "err", err)
+			return c.cert, nil
+		}
+		return nil, err
+	}
+	if c.cert != nil {
+		slog.Info("tls certificate reloaded", "cert", c.certFile)
+	}
+	c.cert, c.modTime = &cert, latest
+	return c.cert, nil
+}
+
+// redirectToHTTPS — обработчик HTTP-порта при включённом TLS: постоянный редирект
+// на тот же путь по HTTPS; порт указывается, только если он не 443
+func redirectToHTTPS(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			// Адрес без порта: IPv6 приходит в скобках — [2001:db8::1]
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		switch {
+		case port != "" && port != "443":
+			host = net.JoinHostPort(host, port)
+		case strings.Contains(host, ":"):
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// withHSTS велит браузеру ходить на сайт только по HTTPS
+func withHSTS(maxAge int, next http.Handler) http.Handler {
+	value := "max-age=" + strconv.Itoa(maxAge)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve обслуживает h, пока не отменён ctx, затем перестаёт принимать соединения
+// и ждёт завершения текущих запросов не дольше Shutdown
+func serve(ctx context.Context, h http.Handler) error {
+	c, err := loadListenConfig()
+	if err != nil {
+		return err
+	}
+	login.SetSecureCookies(c.TLS())
+
+	t := loadServerTimeouts()
+	newServer := func(addr string, h http.Handler) *http.Server {
+		return &http.Server{
+			Addr:              addr,
+			Handler:           h,
+			ReadHeaderTimeout: t.ReadHeader,
+			ReadTimeout:       t.Read,
+			WriteTimeout:      t.Write,
+			IdleTimeout:       t.Idle,
+			ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+		}
+	}
+
+	var servers []*http.Server
+	errc := make(chan error, 2)
+	if c.TLS() {
+		tlsConfig, httpHandler, err := tlsSetup(c)
+		if err != nil {
+			return err
+		}
+		srv := newServer(c.HTTPSAddr, withHSTS(c.HSTSMaxAge, h))
+		srv.TLSConfig = tlsConfig
+		redirect := newServer(c.HTTPAddr, httpHandler)
+		servers = append(servers, srv, redirect)
+		go func() {
+			slog.Info("server listening", "addr", srv.Addr, "tls", true, "autocert", c.Autocert())
+			errc <- srv.ListenAndServeTLS("", "")
+		}()
+		go func() {
+			slog.Info("redirecting to https", "addr", redirect.Addr)
+			errc <- redirect.ListenAndServe()
+		}()
+	} else {
+		srv := newServer(c.HTTPAddr, h)
+		servers = append(servers, srv)
+		go func() {
+			slog.Info("server listening", "addr", srv.Addr, "tls", false)
+			errc <- srv.ListenAndServe()
+		}()
+	}
+
+	var serveErr error
+	select {
+	case serveErr = <-errc:
+		// Один из серверов не поднялся — останавливаем остальные
+	case <-ctx.Done():
+	}
+
+	shuttingDown.Store(true)
+	slog.Info("shutting down, draining requests", "timeout", t.Shutdown.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), t.Shutdown)
+	defer cancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			// Не уложились — обрываем оставшиеся соединения
+			srv.Close()
+			if serveErr == nil {
+				serveErr = err
+			}
+		}
+	}
+	if errors.Is(serveErr, http.ErrServerClosed) {
+		serveErr = nil
+	}
+	return serveErr
+}
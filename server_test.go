@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		host      string
+		target    string
+		want      string
+	}{
+		{"default port", ":443", "example.com", "/post/1?x=2", "https://example.com/post/1?x=2"},
+		{"default port, host with http port", ":443", "example.com:8080", "/", "https://example.com/"},
+		{"custom port", ":8443", "example.com:8080", "/a", "https://example.com:8443/a"},
+		{"custom port, host without port", "0.0.0.0:8443", "example.com", "/a", "https://example.com:8443/a"},
+		{"ipv6 host", ":443", "[::1]:8080", "/", "https://[::1]/"},
+		{"ipv6 host, custom port", ":8443", "[::1]:8080", "/", "https://[::1]:8443/"},
+		{"ipv6 host without port", ":8443", "[2001:db8::1]", "/", "https://[2001:db8::1]:8443/"},
+		{"escaped path", ":443", "example.com", "/tag/%D0%B3%D0%BE", "https://example.com/tag/%D0%B3%D0%BE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.target, nil)
+			r.Host = tt.host
+			rec := httptest.NewRecorder()
+			redirectToHTTPS(tt.httpsAddr).ServeHTTP(rec, r)
+			if rec.Code != http.StatusMovedPermanently {
+				t.Errorf("status %d, want 301", rec.Code)
+			}
+			if got := rec.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadListenConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    listenConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: listenConfig{HTTPAddr: ":8080", HTTPSAddr: ":8443", AutocertCache: "autocert-cache", HSTSMaxAge: 365 * 24 * 60 * 60},
+		},
+		{
+			name: "files",
+			env:  map[string]string{"HTTP_ADDR": ":80", "HTTPS_ADDR": ":443", "TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "HSTS_MAX_AGE": "60"},
+			want: listenConfig{HTTPAddr: ":80", HTTPSAddr: ":443", CertFile: "cert.pem", KeyFile: "key.pem", AutocertCache: "autocert-cache", HSTSMaxAge: 60},
+		},
+		{
+			name: "autocert",
+			env:  map[string]string{"TLS_AUTOCERT_DOMAINS": " example.com, www.example.com ,", "TLS_AUTOCERT_CACHE": "/var/cache/site"},
+			want: listenConfig{HTTPAddr: ":8080", HTTPSAddr: ":8443", AutocertDomains: []string{"example.com", "www.example.com"},
+				AutocertCache: "/var/cache/site", HSTSMaxAge: 365 * 24 * 60 * 60},
+		},
+		{name: "cert without key", env: map[string]string{"TLS_CERT_FILE": "cert.pem"}, wantErr: true},
+		{name: "key without cert", env: map[string]string{"TLS_KEY_FILE": "key.pem"}, wantErr: true},
+		{
+			name:    "autocert and files",
+			env:     map[string]string{"TLS_CERT_FILE": "cert.pem", "TLS_KEY_FILE": "key.pem", "TLS_AUTOCERT_DOMAINS": "example.com"},
+			wantErr: true,
+		},
+	}
+	vars := []string{"HTTP_ADDR", "HTTPS_ADDR", "TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_AUTOCERT_DOMAINS", "TLS_AUTOCERT_CACHE", "HSTS_MAX_AGE"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range vars {
+				t.Setenv(name, tt.env[name])
+			}
+			got, err := loadListenConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadListenConfig() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadListenConfig() = %+v, want %+v", got, tt.want)
+			}
+			if got.TLS() != (tt.want.CertFile != "" || len(tt.want.AutocertDomains) > 0) {
+				t.Errorf("TLS() = %v", got.TLS())
+			}
+		})
+	}
+}
+
+// writeCert пишет самоподписанный сертификат для cn и его ключ; mtime — время изменения файлов
+func writeCert(t *testing.T, certFile, keyFile, cn string, mtime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct {
+		name  string
+		block *pem.Block
+	}{
+		{certFile, &pem.Block{Type: "CERTIFICATE", Bytes: der}},
+		{keyFile, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}},
+	} {
+		if err := os.WriteFile(f.name, pem.EncodeToMemory(f.block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f.name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+
+	commonName := func(c *certReloader) string {
+		t.Helper()
+		cert, err := c.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+
+	missing := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := missing.GetCertificate(nil); err == nil {
+		t.Fatal("GetCertificate without files succeeded")
+	}
+
+	writeCert(t, certFile, keyFile, "first", start)
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if got := commonName(c); got != "first" {
+		t.Fatalf("initial certificate %q, want first", got)
+	}
+	first, _ := c.GetCertificate(nil)
+	if again, _ := c.GetCertificate(nil); again != first {
+		t.Error("unchanged files were parsed again")
+	}
+
+	// Продлённый сертификат подхватывается по времени изменения файлов
+	writeCert(t, certFile, keyFile, "second", start.Add(time.Second))
+	if got := commonName(c); got != "second" {
+		t.Errorf("after renewal %q, want second", got)
+	}
+
+	// Файл переписывается прямо сейчас: остаётся прежний сертификат
+	if err := os.WriteFile(certFile, []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, start.Add(2*time.Second), start.Add(2*time.Second))
+	if got := commonName(c); got != "second" {
+		t.Errorf("with a broken file %q, want the previous certificate", got)
+	}
+}
+
+func TestTLSSetupAutocert(t *testing.T) {
+	c := listenConfig{HTTPSAddr: ":443", AutocertDomains: []string{"example.com"}, AutocertCache: t.TempDir()}
+	cfg, httpHandler, err := tlsSetup(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GetCertificate == nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("tls config %+v", cfg)
+	}
+	if !slices.Contains(cfg.NextProtos, "acme-tls/1") {
+		t.Errorf("NextProtos %v lack the ACME TLS-ALPN challenge", cfg.NextProtos)
+	}
+	// Чужой домен сертификат не получает
+	if _, err := cfg.GetCertificate(&tls.ClientHelloInfo{ServerName: "evil.example"}); err == nil {
+		t.Error("certificate requested for a domain outside TLS_AUTOCERT_DOMAINS")
+	}
+
+	// Обычные запросы на HTTP-порт по-прежнему перенаправляются на HTTPS
+	r := httptest.NewRequest("GET", "/post/1", nil)
+	r.Host = "example.com"
+	rec := httptest.NewRecorder()
+	httpHandler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != "https://example.com/post/1" {
+		t.Errorf("status %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+}
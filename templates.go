@@ -0,0 +1,57 @@
+package main
+
+import (
+	"html/template"
+	"io/fs"
+	"net/http"
+	"site/views"
+)
+
+// templateFuncs — функции, доступные во всех шаблонах; адреса статики берутся из a
+func templateFuncs(a *staticAssets) template.FuncMap {
+	return template.FuncMap{
+		// date и datetime показывают время в часовом поясе сайта
+		"date":     formatDate,
+		"datetime": formatDateTime,
+		// asset — адрес статического файла с отпечатком: {{asset "css/main.css"}}
+		"asset": a.URL,
+		// bytes — размер в человекочитаемом виде: {{bytes .Size}} → «1.5 МБ»
+		"bytes": formatBytes,
+	}
+}
+
+// loadTemplates разбирает шаблоны из html/ и считает отпечатки статики один раз при старте;
+// ошибка в шаблоне не даёт серверу запуститься. В режиме разработки (SITE_DEV=1) шаблоны
+// перечитываются при изменении файлов, без перезапуска сервера.
+func loadTemplates(files fs.FS) (*views.Registry, *staticAssets, error) {
+	a, err := newStaticAssets(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	html, err := fs.Sub(files, "html")
+	if err != nil {
+		return nil, nil, err
+	}
+	reg, err := views.New(html, templateFuncs(a), devMode())
+	if err != nil {
+		return nil, nil, err
+	}
+	return reg, a, nil
+}
+
+// withTemplates кладёт реестр шаблонов в контекст запроса, откуда его берут render и writeError
+func withTemplates(reg *views.Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(views.WithRegistry(r.Context(), reg)))
+	})
+}
+
+// render показывает страницу name с кодом status
+func render(w http.ResponseWriter, r *http.Request, status int, name string, data any) {
+	views.FromContext(r.Context()).Render(w, r, status, name, data)
+}
+
+// writeError показывает страницу ошибки; подробности внутренних ошибок — только в лог
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	views.FromContext(r.Context()).Error(w, r, err)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"site/views"
+	"strings"
+	"testing"
+)
+
+// pageData — нулевые данные каждой страницы того типа, который передают обработчики
+var pageData = map[string]any{
+	"Show": PageData{},
+	"Today": struct {
+		Posts                     []Post
+		IsAuthenticated, IsEditor bool
+		Today                     string
+		Calendar                  *Calendar
+		Meta                      *PageMeta
+	}{},
+	"account":              AccountData{},
+	"admin":                AdminData{},
+	"archive":              ArchiveData{},
+	"confirm":              map[string]string{},
+	"confirm_code":         nil,
+	"confirmation-success": nil,
+	"connect":              []Post{},
+	"creat":                FormData{},
+	"diff":                 []DiffPart{},
+	"edit":                 FormData{},
+	"error":                views.ErrorPage{},
+	"history":              HistoryData{},
+	"main":                 TemplateData{},
+	"reg":                  nil,
+	"trash":                TrashData{},
+}
+
+func TestLoadTemplates(t *testing.T) {
+	reg, _, err := loadTemplates(embeddedFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := reg.Names()
+	if len(names) == 0 {
+		t.Fatal("no pages loaded")
+	}
+	for _, name := range names {
+		data, ok := pageData[name]
+		if !ok {
+			t.Errorf("page %q has no entry in pageData", name)
+			continue
+		}
+		rec := httptest.NewRecorder()
+		reg.Render(rec, httptest.NewRequest("GET", "/", nil), http.StatusOK, name, data)
+		if rec.Code != http.StatusOK {
+			t.Errorf("render %q: status %d: %s", name, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestRenderErrorDetail(t *testing.T) {
+	for _, dev := range []bool{false, true} {
+		html, err := fs.Sub(embeddedFiles, "html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		reg, err := views.New(html, templateFuncs(&staticAssets{}), dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		reg.Render(rec, httptest.NewRequest("GET", "/", nil), http.StatusOK, "no-such-page", nil)
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("dev=%v: status %d, want 500", dev, rec.Code)
+		}
+		if got := strings.Contains(rec.Body.String(), "no-such-page"); got != dev {
+			t.Errorf("dev=%v: body mentions template name = %v: %s", dev, got, rec.Body)
+		}
+	}
+}
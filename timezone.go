@@ -0,0 +1,67 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// siteLocation — часовой пояс сайта (SITE_TIMEZONE, например Europe/Moscow; по умолчанию
+// пояс сервера). В нём считается «сегодня», границы дней архива и все даты в шаблонах.
+// Время в БД хранится в UTC.
+var siteLocation = sync.OnceValue(func() *time.Location {
+	name := os.Getenv("SITE_TIMEZONE")
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		log.Printf("Invalid SITE_TIMEZONE %q, using server time zone: %v\n", name, err)
+		return time.Local
+	}
+	return loc
+})
+
+// siteNow — текущее время в часовом поясе сайта
+func siteNow() time.Time {
+	return time.Now().In(siteLocation())
+}
+
+// midnight — первый момент дня в часовом поясе сайта; day вне месяца нормализуется,
+// как в time.Date. Где часы переводят ровно в полночь (например, America/Havana), 00:00
+// не существует, и time.Date отдаёт момент предыдущего дня — тогда день начинается с перевода.
+func midnight(year int, month time.Month, day int) time.Time {
+	t := time.Date(year, month, day, 0, 0, 0, 0, siteLocation())
+	if t.Hour() != 0 {
+		// Момент из пропущенного часа time.Date сдвигает в одну из сторон от перевода
+		start, end := t.ZoneBounds()
+		if t.Hour() >= 12 {
+			return end
+		}
+		return start
+	}
+	return t
+}
+
+// dayStart — начало дня t в часовом поясе сайта
+func dayStart(t time.Time) time.Time {
+	t = t.In(siteLocation())
+	return midnight(t.Year(), t.Month(), t.Day())
+}
+
+// nextDay — начало следующего дня; сутки в дни перевода часов длиннее или короче 24 часов
+func nextDay(start time.Time) time.Time {
+	start = start.In(siteLocation())
+	return midnight(start.Year(), start.Month(), start.Day()+1)
+}
+
+// formatDate — дата в часовом поясе сайта, для шаблонов
+func formatDate(t time.Time) string {
+	return t.In(siteLocation()).Format("02.01.2006")
+}
+
+// formatDateTime — дата и время в часовом поясе сайта, для шаблонов
+func formatDateTime(t time.Time) string {
+	return t.In(siteLocation()).Format("02.01.2006 15:04")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// withSiteLocation подменяет часовой пояс сайта на время теста
+func withSiteLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no tzdata for %s: %v", name, err)
+	}
+	prev := siteLocation
+	siteLocation = func() *time.Location { return loc }
+	t.Cleanup(func() { siteLocation = prev })
+	return loc
+}
+
+func TestArchiveDayAcrossDST(t *testing.T) {
+	withSiteLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		name               string
+		year, month, day   int
+		wantStart, wantEnd string // границы дня в UTC, как они уходят в запрос
+		wantHours          float64
+	}{
+		{"переход на летнее время", 2026, 3, 29, "2026-03-28T23:00:00Z", "2026-03-29T22:00:00Z", 23},
+		{"переход на зимнее время", 2026, 10, 25, "2026-10-24T22:00:00Z", "2026-10-25T23:00:00Z", 25},
+		{"обычный день", 2026, 7, 1, "2026-06-30T22:00:00Z", "2026-07-01T22:00:00Z", 24},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, ok := archivePeriodStart(tt.year, tt.month, tt.day)
+			if !ok {
+				t.Fatal("date rejected")
+			}
+			end := start.AddDate(0, 0, 1)
+			if got := start.UTC().Format(time.RFC3339); got != tt.wantStart {
+				t.Errorf("start = %s, want %s", got, tt.wantStart)
+			}
+			if got := end.UTC().Format(time.RFC3339); got != tt.wantEnd {
+				t.Errorf("end = %s, want %s", got, tt.wantEnd)
+			}
+			if got := end.Sub(start).Hours(); got != tt.wantHours {
+				t.Errorf("day length = %vh, want %vh", got, tt.wantHours)
+			}
+		})
+	}
+}
+
+// Статья, сохранённая в UTC около полуночи по местному времени, попадает в местный день
+func TestDayOfUTCTimestampAcrossDST(t *testing.T) {
+	withSiteLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		utc      string
+		wantDate string
+		wantDay  string // dayStart в UTC
+	}{
+		{"2026-03-28T22:59:00Z", "28.03.2026", "2026-03-27T23:00:00Z"},
+		{"2026-03-28T23:00:00Z", "29.03.2026", "2026-03-28T23:00:00Z"},
+		{"2026-03-29T21:59:00Z", "29.03.2026", "2026-03-28T23:00:00Z"},
+		{"2026-03-29T22:00:00Z", "30.03.2026", "2026-03-29T22:00:00Z"},
+		{"2026-10-25T22:59:00Z", "25.10.2026", "2026-10-24T22:00:00Z"},
+		{"2026-10-25T23:00:00Z", "26.10.2026", "2026-10-25T23:00:00Z"},
+	}
+	for _, tt := range tests {
+		ts, err := time.Parse(time.RFC3339, tt.utc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatDate(ts); got != tt.wantDate {
+			t.Errorf("formatDate(%s) = %s, want %s", tt.utc, got, tt.wantDate)
+		}
+		if got := dayStart(ts).UTC().Format(time.RFC3339); got != tt.wantDay {
+			t.Errorf("dayStart(%s) = %s, want %s", tt.utc, got, tt.wantDay)
+		}
+	}
+}
+
+// На Кубе часы переводят в полночь: 00:00 8 марта 2026 не существует, но день есть
+func TestArchiveDaySkippedMidnight(t *testing.T) {
+	withSiteLocation(t, "America/Havana")
+
+	start, ok := archivePeriodStart(2026, 3, 8)
+	if !ok {
+		t.Fatal("day with skipped midnight rejected")
+	}
+	if start.Day() != 8 || start.Hour() != 1 {
+		t.Errorf("start = %s, want 01:00 on March 8", start)
+	}
+	if _, ok := archivePeriodStart(2026, 2, 31); ok {
+		t.Error("31.02 accepted")
+	}
+}
+
+// Календарь месяца с пропущенной полуночью: каждый день ровно один раз и по порядку
+func TestMidnightEveryDayOfMonth(t *testing.T) {
+	withSiteLocation(t, "America/Havana")
+
+	for day := 1; day <= 31; day++ {
+		d := midnight(2026, time.March, day)
+		if d.Day() != day || d.Month() != time.March {
+			t.Errorf("midnight(2026-03-%02d) = %s", day, d)
+		}
+		if next := nextDay(d); next.Sub(d) < 23*time.Hour || next.Sub(d) > 25*time.Hour {
+			t.Errorf("day %d lasts %s", day, next.Sub(d))
+		}
+	}
+	if got := nextDay(midnight(2026, time.March, 7)); got.Day() != 8 || got.Hour() != 1 {
+		t.Errorf("nextDay(7 March) = %s, want 01:00 on 8 March", got)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"site/login"
+	"site/views"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// TrashedPost — пост в корзине и дата, после которой он будет удалён автоматически
+type TrashedPost struct {
+	Post
+	DeletedAt time.Time
+	PurgeAt   time.Time
+}
+
+type TrashData struct {
+	Posts           []TrashedPost
+	RetentionDays   int
+	IsAuthenticated bool
+}
+
+// trashRetention — сколько дней пост хранится в корзине (TRASH_RETENTION_DAYS, по умолчанию 30)
+func trashRetention() time.Duration {
+	days := 30
+	if v := os.Getenv("TRASH_RETENTION_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			days = n
+		} else {
+			slog.Warn("invalid TRASH_RETENTION_DAYS, using default", "value", v, "default_days", days)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// trashHandler — GET /trash, список удалённых постов (только для редакторов)
+func trashHandler(w http.ResponseWriter, r *http.Request) {
+	if !login.IsEditor(r) {
+		writeError(w, r, views.Forbidden("Корзина доступна только редакторам"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	rows, err := db.Query(
+		`SELECT id, title, anons, full_text, photo_id, created_at, deleted_at
+           FROM post WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`,
+	)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка чтения корзины", err))
+		return
+	}
+	defer rows.Close()
+
+	retention := trashRetention()
+	var posts []TrashedPost
+	for rows.Next() {
+		var p TrashedPost
+		if err := rows.Scan(&p.Id, &p.Title, &p.Anons, &p.Full_text, &p.PhotoID, &p.CreatedAt, &p.DeletedAt); err != nil {
+			writeError(w, r, views.Internal("Ошибка сканирования поста", err))
+			return
+		}
+		p.PurgeAt = p.DeletedAt.Add(retention)
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, views.Internal("Ошибка после обхода корзины", err))
+		return
+	}
+
+	data := TrashData{
+		Posts:           posts,
+		RetentionDays:   int(retention.Hours() / 24),
+		IsAuthenticated: true,
+	}
+	render(w, r, http.StatusOK, "trash", data)
+}
+
+// restoreTrashHandler — POST /trash/{id}/restore, возвращает пост из корзины
+func restoreTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if !login.IsEditor(r) {
+		writeError(w, r, views.Forbidden("Корзина доступна только редакторам"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	res, err := db.Exec("UPDATE post SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL", mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка восстановления поста", err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, r, views.NotFound("Статья не найдена в корзине"))
+		return
+	}
+	slog.Info("post restored from trash", "request_id", views.RequestID(r.Context()), "post_id", mux.Vars(r)["id"])
+
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// purgeTrashHandler — POST /trash/{id}/purge, окончательно удаляет пост из корзины
+func purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if !login.IsEditor(r) {
+		writeError(w, r, views.Forbidden("Корзина доступна только редакторам"))
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, views.BadRequest("Некорректный ID"))
+		return
+	}
+
+	db, err := requestDB(r)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка подключения к БД", err))
+		return
+	}
+	defer db.Close()
+
+	found, err := purgePost(db, id)
+	if err != nil {
+		writeError(w, r, views.Internal("Ошибка удаления поста", err))
+		return
+	}
+	if !found {
+		writeError(w, r, views.NotFound("Статья не найдена в корзине"))
+		return
+	}
+	slog.Info("post purged from trash", "request_id", views.RequestID(r.Context()), "post_id", id)
+
+	http.Redirect(w, r, "/trash", http.StatusSeeOther)
+}
+
+// purgePost окончательно удаляет пост из корзины вместе с комментариями, ревизиями и галереей.
+// Фотографии, на которые больше никто не ссылается, удалит сборщик файлов (gc.go).
+// Возвращает false, если поста нет в корзине.
+func purgePost(db *DB, id int) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Комментарии, затем сам пост (ревизии и галерея удаляются каскадом)
+	if _, err := tx.Exec("DELETE FROM comments WHERE post_id = $1 AND EXISTS (SELECT 1 FROM post WHERE id = $1 AND deleted_at IS NOT NULL)", id); err != nil {
+		return false, err
+	}
+	res, err := tx.Exec("DELETE FROM post WHERE id = $1 AND deleted_at IS NOT NULL", id)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+
+	return true, tx.Commit()
+}
+
+// purgeExpiredPosts удаляет посты, пролежавшие в корзине дольше срока хранения
+func purgeExpiredPosts(ctx context.Context, retention time.Duration) error {
+	db, err := contextDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(
+		"SELECT id FROM post WHERE deleted_at IS NOT NULL AND deleted_at < now() - $1 * interval '1 second'",
+		retention.Seconds(),
+	)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := purgePost(db, id); err != nil {
+			return err
+		}
+		slog.Info("expired post purged from trash", "job", "trash-purge", "post_id", id)
+	}
+	return nil
+}
+
+// runTrashPurger раз в час очищает корзину от просроченных постов, пока не отменён ctx
+func runTrashPurger(ctx context.Context) {
+	retention := trashRetention()
+	for {
+		if err := purgeExpiredPosts(ctx, retention); err != nil && ctx.Err() == nil {
+			slog.Error("trash purge failed", "job", "trash-purge", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Hour):
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"site/login"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTrashRetention(t *testing.T) {
+	for _, tt := range []struct {
+		env  string
+		days int
+	}{{"", 30}, {"7", 7}, {"0", 30}, {"-1", 30}, {"неделя", 30}} {
+		t.Setenv("TRASH_RETENTION_DAYS", tt.env)
+		if got := trashRetention(); got != time.Duration(tt.days)*24*time.Hour {
+			t.Errorf("TRASH_RETENTION_DAYS=%q: %v, want %d days", tt.env, got, tt.days)
+		}
+	}
+}
+
+func TestRestoreTrash(t *testing.T) {
+	editor := &login.Principal{Email: "editor@example.com", Role: "editor"}
+	user := &login.Principal{Email: "user@example.com", Role: "user"}
+	tests := []struct {
+		name      string
+		principal *login.Principal
+		affected  int64
+		status    int
+		wantQuery bool
+	}{
+		{"restored", editor, 1, http.StatusSeeOther, true},
+		{"not in trash", editor, 0, http.StatusNotFound, true},
+		{"not an editor", user, 1, http.StatusForbidden, false},
+		{"guest", nil, 1, http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := useFakeDB(t, func(string, []driver.Value) fakeResult { return fakeResult{Affected: tt.affected} })
+			r := httptest.NewRequest("POST", "/trash/7/restore", nil)
+			r = mux.SetURLVars(r, map[string]string{"id": "7"})
+			if tt.principal != nil {
+				r = login.WithPrincipal(r, tt.principal)
+			}
+			rec := httptest.NewRecorder()
+			restoreTrashHandler(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusSeeOther && rec.Header().Get("Location") != "/trash" {
+				t.Errorf("Location %q", rec.Header().Get("Location"))
+			}
+			qs := f.Queries()
+			if !tt.wantQuery {
+				if len(qs) != 0 {
+					t.Errorf("queries %q without editor rights", f.SQL())
+				}
+				return
+			}
+			if len(qs) != 1 || !strings.HasPrefix(qs[0].SQL, "UPDATE post SET deleted_at = NULL") ||
+				!strings.Contains(qs[0].SQL, "deleted_at IS NOT NULL") || qs[0].Args[0] != "7" {
+				t.Errorf("queries %+v, want a restore of post 7 from the trash only", qs)
+			}
+		})
+	}
+}
+
+func TestPurgeExpiredPosts(t *testing.T) {
+	now := time.Now()
+	deletedAt := map[int64]time.Time{
+		1: now.Add(-31 * 24 * time.Hour), // просрочен
+		2: now.Add(-29 * 24 * time.Hour), // ещё хранится
+		3: now.Add(-90 * 24 * time.Hour), // просрочен
+	}
+	f := useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		switch {
+		case strings.HasPrefix(query, "SELECT id FROM post"):
+			// Срок хранения приходит в секундах, как его подставляет PostgreSQL в interval
+			cutoff := now.Add(-time.Duration(args[0].(float64) * float64(time.Second)))
+			res := fakeResult{Cols: []string{"id"}}
+			for _, id := range []int64{1, 2, 3} {
+				if deletedAt[id].Before(cutoff) {
+					res.Rows = append(res.Rows, []driver.Value{id})
+				}
+			}
+			return res
+		case strings.HasPrefix(query, "DELETE"):
+			return fakeResult{Affected: 1}
+		}
+		return fakeResult{}
+	})
+
+	if err := purgeExpiredPosts(context.Background(), 30*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	var purged []driver.Value
+	for _, q := range f.Queries() {
+		if strings.HasPrefix(q.SQL, "DELETE FROM post WHERE") {
+			if !strings.Contains(q.SQL, "deleted_at IS NOT NULL") {
+				t.Errorf("purge is not limited to the trash: %s", q.SQL)
+			}
+			purged = append(purged, q.Args[0])
+		}
+	}
+	if want := []driver.Value{int64(1), int64(3)}; !reflect.DeepEqual(purged, want) {
+		t.Errorf("purged %v, want %v", purged, want)
+	}
+	var commits int
+	for _, q := range f.SQL() {
+		if q == "COMMIT" {
+			commits++
+		}
+	}
+	if commits != 2 {
+		t.Errorf("%d commits, want each post purged in its own transaction:\n%q", commits, f.SQL())
+	}
+}
+
+func TestPurgeExpiredPostsError(t *testing.T) {
+	useFakeDB(t, func(query string, args []driver.Value) fakeResult {
+		return fakeResult{Err: errors.New("connection refused")}
+	})
+	if err := purgeExpiredPosts(context.Background(), time.Hour); err == nil {
+		t.Error("database error is lost")
+	}
+}
+
+// postQuery — запрос к самой таблице post, а не к post_tags, post_media и т. п.
+var postQuery = regexp.MustCompile(`FROM post(\s|$)`)
+
+func TestTrashedPostsHidden(t *testing.T) {
+	t.Setenv("SITE_URL", "https://example.com")
+	rtr := newRouter(nil, nil, nil)
+	tests := []struct {
+		path   string
+		status int // 0 — любой
+	}{
+		{"/", 0},
+		{"/feed.rss", 0},
+		{"/sitemap-1.xml", 0},
+		{"/archive/2025", 0},
+		{"/api/v1/posts", 0},
+		{"/post/2", http.StatusNotFound},
+		{"/api/v1/posts/2", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			// Пустая БД: пост 2 в корзине, и запрос с фильтром его не находит
+			f := useFakeDB(t, nil)
+			rec := httptest.NewRecorder()
+			rtr.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+			if tt.status != 0 && rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+
+			var checked int
+			for _, q := range f.SQL() {
+				if !postQuery.MatchString(q) {
+					continue
+				}
+				checked++
+				if !strings.Contains(q, "deleted_at IS NULL") || !strings.Contains(q, "unpublished_at IS NULL") {
+					t.Errorf("query shows trashed or unpublished posts: %s", q)
+				}
+			}
+			if checked == 0 {
+				t.Errorf("no query to post, ran %q", f.SQL())
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// maxFieldBytes — предел для обычного (не файлового) поля формы, например full_text
+const maxFieldBytes = 2 << 20
+
+// UploadLimits — ограничения на загрузку; настраиваются переменными окружения
+type UploadLimits struct {
+	MaxFileBytes    int64    // UPLOAD_MAX_FILE_BYTES, по умолчанию 10 МБ
+	MaxRequestBytes int64    // UPLOAD_MAX_REQUEST_BYTES, по умолчанию 50 МБ
+	AllowedTypes    []string // UPLOAD_ALLOWED_TYPES через запятую, подмножество imageTypes; по умолчанию все они
+}
+
+func uploadLimits() UploadLimits {
+	l := UploadLimits{
+		MaxFileBytes:    envBytes("UPLOAD_MAX_FILE_BYTES", 10<<20),
+		MaxRequestBytes: envBytes("UPLOAD_MAX_REQUEST_BYTES", 50<<20),
+		AllowedTypes:    imageTypes,
+	}
+	if v := os.Getenv("UPLOAD_ALLOWED_TYPES"); v != "" {
+		// Каждая загрузка проходит через processImage, поэтому разрешить можно только
+		// типы, которые он умеет перекодировать; остальные игнорируются
+		var types []string
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			if !typeAllowed(t, imageTypes) {
+				slog.Warn("UPLOAD_ALLOWED_TYPES: not a supported image type, ignored", "type", t)
+				continue
+			}
+			types = append(types, t)
+		}
+		if len(types) > 0 {
+			l.AllowedTypes = types
+		} else {
+			slog.Warn("UPLOAD_ALLOWED_TYPES has no supported image types, using default", "value", v)
+		}
+	}
+	return l
+}
+
+func envBytes(name string, def int64) int64 {
+	if v := os.Getenv(name); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+		slog.Warn("invalid byte size setting, using default", "name", name, "value", v, "default", def)
+	}
+	return def
+}
+
+// UploadError — ошибка загрузки, которую нужно показать пользователю на странице формы
+type UploadError struct {
+	Status  int
+	Message string
+}
+
+func (e *UploadError) Error() string { return e.Message }
+
+func (e *UploadError) HTTPStatus() int { return e.Status }
+
+// Upload — загруженный файл, сброшенный во временный файл на диске
+type Upload struct {
+	Filename string
+	Mime     string // тип, определённый по содержимому
+	Size     int64
+	Hash     string // SHA-256 содержимого, hex
+	Path     string
+}
+
+// UploadForm — разобранная multipart-форма: текстовые поля и файлы по именам полей
+type UploadForm struct {
+	Values url.Values
+	Files  map[string][]*Upload
+}
+
+// Cleanup удаляет временные файлы загрузок
+func (f *UploadForm) Cleanup() {
+	for _, ups := range f.Files {
+		for _, up := range ups {
+			os.Remove(up.Path)
+		}
+	}
+}
+
+// parseUploadForm читает multipart-форму потоково: поля — в память (с пределом maxFieldBytes),
+// файлы — сразу во временные файлы. Превышение пределов даёт UploadError 413,
+// недопустимый тип файла — UploadError 415. При ошибке временные файлы уже удалены,
+// а в Values остаются поля, прочитанные до неё, чтобы форму можно было показать заново.
+func parseUploadForm(w http.ResponseWriter, r *http.Request, limits UploadLimits) (*UploadForm, error) {
+	form := &UploadForm{Values: url.Values{}, Files: map[string][]*Upload{}}
+
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxRequestBytes)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return form, &UploadError{Status: http.StatusBadRequest, Message: "Ожидалась multipart-форма: " + err.Error()}
+	}
+
+	fail := func(err error) (*UploadForm, error) {
+		form.Cleanup()
+		form.Files = map[string][]*Upload{}
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			return form, &UploadError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Message: fmt.Sprintf("Запрос больше допустимых %s", formatBytes(limits.MaxRequestBytes)),
+			}
+		}
+		return form, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fail(err)
+		}
+
+		name := part.FormName()
+		if name == "" {
+			part.Close()
+			continue
+		}
+
+		if part.FileName() == "" {
+			var buf bytes.Buffer
+			n, err := io.Copy(&buf, io.LimitReader(part, maxFieldBytes+1))
+			part.Close()
+			if err != nil {
+				return fail(err)
+			}
+			if n > maxFieldBytes {
+				return fail(&UploadError{
+					Status:  http.StatusRequestEntityTooLarge,
+					Message: fmt.Sprintf("Поле %q больше допустимых %s", name, formatBytes(maxFieldBytes)),
+				})
+			}
+			form.Values.Add(name, buf.String())
+			continue
+		}
+
+		up, err := spoolPart(part, limits)
+		part.Close()
+		if err != nil {
+			return fail(err)
+		}
+		if up == nil {
+			// Пустое поле файла: браузер шлёт его, если ничего не выбрано
+			continue
+		}
+		uploadSize.Observe(float64(up.Size))
+		form.Files[name] = append(form.Files[name], up)
+	}
+	return form, nil
+}
+
+// spoolPart копирует файловую часть формы во временный файл, попутно считая хэш
+// и проверяя размер и тип по первым байтам. Для пустой части возвращает nil.
+func spoolPart(part *multipart.Part, limits UploadLimits) (*Upload, error) {
+	filename := part.FileName()
+
+	// Тип определяем по содержимому, а не по заголовку, присланному браузером
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	head = head[:n]
+	if n == 0 {
+		return nil, nil
+	}
+	mime := http.DetectContentType(head)
+	if !typeAllowed(mime, limits.AllowedTypes) {
+		return nil, &UploadError{
+			Status:  http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("Файл %q имеет недопустимый тип %s (разрешены: %s)", filename, mime, strings.Join(limits.AllowedTypes, ", ")),
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	up := &Upload{Filename: filename, Mime: mime, Path: tmp.Name()}
+
+	h := sha256.New()
+	src := io.MultiReader(bytes.NewReader(head), part)
+	size, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(src, limits.MaxFileBytes+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && size > limits.MaxFileBytes {
+		err = &UploadError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Файл %q больше допустимых %s", filename, formatBytes(limits.MaxFileBytes)),
+		}
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	up.Size = size
+	up.Hash = hex.EncodeToString(h.Sum(nil))
+	return up, nil
+}
+
+func typeAllowed(mime string, allowed []string) bool {
+	for _, t := range allowed {
+		if t == mime {
+			return true
+		}
+	}
+	return false
+}
+
+// formatBytes — размер в человекочитаемом виде для сообщений об ошибках и шаблонов
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f МБ", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f КБ", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d Б", n)
+}
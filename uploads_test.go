@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// formPart — часть multipart-тела: поле, если filename пустое, иначе файл
+type formPart struct {
+	name, filename string
+	data           []byte
+}
+
+// multipartRequest собирает POST с multipart-телом из parts
+func multipartRequest(t *testing.T, parts ...formPart) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		var err error
+		if p.filename == "" {
+			err = mw.WriteField(p.name, string(p.data))
+		} else {
+			var fw io.Writer
+			fw, err = mw.CreateFormFile(p.name, p.filename)
+			if err == nil {
+				_, err = fw.Write(p.data)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/save_article", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+// pngOfSize — PNG-заголовок, дополненный до size байт: по первым байтам это image/png
+func pngOfSize(size int) []byte {
+	data := pngHeader(10, 10)
+	return append(data, make([]byte, size-len(data))...)
+}
+
+// tempFiles — файлы во временном каталоге загрузок
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestParseUploadForm(t *testing.T) {
+	limits := UploadLimits{MaxFileBytes: 1000, MaxRequestBytes: 3000, AllowedTypes: []string{"image/png"}}
+	title := formPart{name: "title", data: []byte("Заголовок")}
+	photo := pngOfSize(500)
+
+	tests := []struct {
+		name   string
+		parts  []formPart
+		status int // 0 — без ошибки
+		files  int
+	}{
+		{"fields and file", []formPart{title, {"photo", "a.png", photo}}, 0, 1},
+		{"two files", []formPart{title, {"photo", "a.png", photo}, {"photo", "b.png", pngOfSize(600)}}, 0, 2},
+		{"no file part", []formPart{title}, 0, 0},
+		{"empty file part", []formPart{title, {"photo", "", nil}, {"photo", "empty.png", nil}}, 0, 0},
+		{"file too large", []formPart{title, {"photo", "big.png", pngOfSize(1001)}}, http.StatusRequestEntityTooLarge, 0},
+		{"file at the limit", []formPart{title, {"photo", "max.png", pngOfSize(1000)}}, 0, 1},
+		{"request too large", []formPart{title, {"photo", "a.png", photo}, {"photo", "b.png", photo}, {"photo", "c.png", photo},
+			{"photo", "d.png", photo}, {"photo", "e.png", photo}, {"photo", "f.png", photo}}, http.StatusRequestEntityTooLarge, 0},
+		{"disallowed type", []formPart{title, {"photo", "a.png", photo}, {"photo", "evil.png", []byte("<html><script>x</script>")}},
+			http.StatusUnsupportedMediaType, 0},
+		{"field too large", []formPart{title, {name: "full_text", data: bytes.Repeat([]byte("a"), maxFieldBytes+1)}},
+			http.StatusRequestEntityTooLarge, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+			l := limits
+			if tt.name == "field too large" {
+				l.MaxRequestBytes = 2 * maxFieldBytes
+			}
+
+			form, err := parseUploadForm(httptest.NewRecorder(), multipartRequest(t, tt.parts...), l)
+			if tt.status != 0 {
+				var uerr *UploadError
+				if !errors.As(err, &uerr) || uerr.Status != tt.status {
+					t.Fatalf("err = %v, want UploadError %d", err, tt.status)
+				}
+				// Поля до ошибки остаются для повторного показа формы, временные файлы удалены
+				if form.Values.Get("title") != "Заголовок" {
+					t.Errorf("title lost after the error: %q", form.Values.Get("title"))
+				}
+				if len(form.Files) != 0 {
+					t.Errorf("files returned with an error: %v", form.Files)
+				}
+				if left := tempFiles(t, dir); len(left) != 0 {
+					t.Errorf("temp files left after the error: %v", left)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(form.Files["photo"]); got != tt.files {
+				t.Fatalf("%d files, want %d", got, tt.files)
+			}
+			if len(tempFiles(t, dir)) != tt.files {
+				t.Errorf("temp files %v, want %d", tempFiles(t, dir), tt.files)
+			}
+			for i, up := range form.Files["photo"] {
+				data, err := os.ReadFile(up.Path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sum := sha256.Sum256(data)
+				want := tt.parts[i+1]
+				if !bytes.Equal(data, want.data) || up.Size != int64(len(data)) || up.Hash != hex.EncodeToString(sum[:]) ||
+					up.Filename != want.filename || up.Mime != "image/png" {
+					t.Errorf("upload %d: %+v", i, up)
+				}
+			}
+			form.Cleanup()
+			if left := tempFiles(t, dir); len(left) != 0 {
+				t.Errorf("temp files left after Cleanup: %v", left)
+			}
+		})
+	}
+
+	t.Run("not multipart", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/save_article", strings.NewReader("title=x"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, err := parseUploadForm(httptest.NewRecorder(), r, limits)
+		var uerr *UploadError
+		if !errors.As(err, &uerr) || uerr.Status != http.StatusBadRequest {
+			t.Errorf("err = %v, want UploadError 400", err)
+		}
+	})
+}
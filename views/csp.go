@@ -0,0 +1,29 @@
+package views
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+type nonceKey struct{}
+
+// WithNonce сохраняет в контексте nonce политики CSP для текущего ответа
+func WithNonce(ctx context.Context, nonce string) context.Context {
+	return context.WithValue(ctx, nonceKey{}, nonce)
+}
+
+// Nonce — nonce CSP текущего запроса или пустая строка
+func Nonce(ctx context.Context) string {
+	nonce, _ := ctx.Value(nonceKey{}).(string)
+	return nonce
+}
+
+// newNoncePlaceholder — метка, которую функция шаблонов cspNonce выводит вместо nonce.
+// Шаблоны разобраны один раз на все запросы, поэтому настоящий nonce подставляется
+// в готовую страницу в Render. Метка случайна, чтобы её нельзя было подсунуть в тексте поста.
+func newNoncePlaceholder() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "csp-nonce-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,151 @@
+package views
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Error — ошибка обработчика с кодом ответа. Message показывается пользователю,
+// Err — внутренняя причина, она попадает только в лог.
+type Error struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// NotFound — страница или объект не найдены (404)
+func NotFound(message string) error {
+	return &Error{Status: http.StatusNotFound, Message: message}
+}
+
+// Unauthorized — нужно войти (401)
+func Unauthorized(message string) error {
+	return &Error{Status: http.StatusUnauthorized, Message: message}
+}
+
+// Forbidden — не хватает прав (403)
+func Forbidden(message string) error {
+	return &Error{Status: http.StatusForbidden, Message: message}
+}
+
+// BadRequest — ошибка в данных запроса (400); message объясняет, что исправить
+func BadRequest(message string) error {
+	return &Error{Status: http.StatusBadRequest, Message: message}
+}
+
+// Internal — внутренняя ошибка (500); пользователь увидит общее сообщение и номер запроса,
+// а message и err уйдут в лог
+func Internal(message string, err error) error {
+	return &Error{Status: http.StatusInternalServerError, Message: message, Err: err}
+}
+
+// StatusError — ошибки других пакетов, которые сами знают свой код ответа
+// (ошибки ввода, загрузки); их текст показывается пользователю как есть
+type StatusError interface {
+	error
+	HTTPStatus() int
+}
+
+// Classify возвращает код ответа и безопасное для пользователя сообщение.
+// Всё, что не распознано, — 500 без подробностей.
+func Classify(err error) (int, string) {
+	var e *Error
+	var se StatusError
+	switch {
+	case errors.As(err, &e):
+		if e.Status >= 500 || e.Message == "" {
+			return e.Status, statusMessage(e.Status)
+		}
+		return e.Status, e.Message
+	case errors.As(err, &se):
+		return se.HTTPStatus(), se.Error()
+	case errors.Is(err, sql.ErrNoRows):
+		return http.StatusNotFound, statusMessage(http.StatusNotFound)
+	}
+	return http.StatusInternalServerError, statusMessage(http.StatusInternalServerError)
+}
+
+func statusMessage(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return "Некорректный запрос"
+	case http.StatusUnauthorized:
+		return "Нужно войти"
+	case http.StatusForbidden:
+		return "Недостаточно прав"
+	case http.StatusNotFound:
+		return "Не найдено"
+	case http.StatusMethodNotAllowed:
+		return "Метод не поддерживается"
+	}
+	if status >= 500 {
+		return "Внутренняя ошибка сервера"
+	}
+	return http.StatusText(status)
+}
+
+// ErrorPage — данные шаблона "error"
+type ErrorPage struct {
+	Status    int
+	Message   string
+	RequestID string
+}
+
+// LogError пишет ошибку в журнал с номером запроса, методом и путём
+func LogError(r *http.Request, err error) {
+	slog.Error("request failed", "request_id", RequestID(r.Context()),
+		"method", r.Method, "path", r.URL.Path, "err", err)
+}
+
+// LogEmail — адрес для журнала: вместо него пишется короткий хэш. Записи одного
+// пользователя по нему связываются, а сам адрес в лог не попадает. Пустой адрес — пустая строка.
+func LogEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(email))
+	return "email:" + hex.EncodeToString(sum[:6])
+}
+
+// Error показывает страницу ошибки. Внутренние ошибки (5xx) логируются с номером запроса,
+// который выводится на странице, — по нему ошибку легко найти в логе.
+func (r *Registry) Error(w http.ResponseWriter, req *http.Request, err error) {
+	status, message := Classify(err)
+	if status >= 500 {
+		LogError(req, err)
+	}
+	if r == nil {
+		http.Error(w, message, status)
+		return
+	}
+	r.Render(w, req, status, "error", ErrorPage{Status: status, Message: message, RequestID: RequestID(req.Context())})
+}
+
+type requestIDKey struct{}
+
+// WithRequestID сохраняет номер запроса в контексте
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID — номер текущего запроса или пустая строка
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,68 @@
+package views
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// statusErr — ошибка другого пакета, знающая свой код (как UploadError)
+type statusErr struct {
+	status int
+	msg    string
+}
+
+func (e statusErr) Error() string   { return e.msg }
+func (e statusErr) HTTPStatus() int { return e.status }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		message string
+	}{
+		{"not found", NotFound("Статья не найдена"), http.StatusNotFound, "Статья не найдена"},
+		{"bad request", BadRequest("Пустой заголовок"), http.StatusBadRequest, "Пустой заголовок"},
+		{"unauthorized", Unauthorized("Войдите"), http.StatusUnauthorized, "Войдите"},
+		{"forbidden", Forbidden("Нет прав"), http.StatusForbidden, "Нет прав"},
+		{"empty message", &Error{Status: http.StatusForbidden}, http.StatusForbidden, "Недостаточно прав"},
+		{"internal hides details", Internal("Ошибка БД", errors.New("password authentication failed")),
+			http.StatusInternalServerError, "Внутренняя ошибка сервера"},
+		{"wrapped", fmt.Errorf("load post: %w", NotFound("Нет поста")), http.StatusNotFound, "Нет поста"},
+		{"status error", statusErr{http.StatusRequestEntityTooLarge, "Файл слишком большой"},
+			http.StatusRequestEntityTooLarge, "Файл слишком большой"},
+		{"wrapped status error", fmt.Errorf("upload: %w", statusErr{http.StatusUnsupportedMediaType, "Не картинка"}),
+			http.StatusUnsupportedMediaType, "Не картинка"},
+		{"no rows", sql.ErrNoRows, http.StatusNotFound, "Не найдено"},
+		{"wrapped no rows", fmt.Errorf("scan: %w", sql.ErrNoRows), http.StatusNotFound, "Не найдено"},
+		{"unknown", errors.New("connection refused"), http.StatusInternalServerError, "Внутренняя ошибка сервера"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, message := Classify(tt.err)
+			if status != tt.status || message != tt.message {
+				t.Errorf("Classify = %d %q, want %d %q", status, message, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestLogEmail(t *testing.T) {
+	h := LogEmail("user@example.com")
+	if h == "" || strings.Contains(h, "user") || strings.Contains(h, "example") {
+		t.Errorf("LogEmail leaks the address: %q", h)
+	}
+	if got := LogEmail(" User@Example.com "); got != h {
+		t.Errorf("LogEmail is not case-insensitive: %q != %q", got, h)
+	}
+	if LogEmail("other@example.com") == h {
+		t.Error("different addresses share a hash")
+	}
+	if LogEmail("") != "" {
+		t.Error("empty address must stay empty")
+	}
+}
@@ -0,0 +1,219 @@
+// Package views — реестр HTML-шаблонов: страницы разбираются один раз при старте,
+// а в режиме разработки перечитываются при изменении файлов.
+//
+// Раскладка каталога шаблонов:
+//
+//	partials/*.html — общие части (шапка, меню, базовый макет "layout"), доступны всем страницам
+//	*.html          — страницы; каждая разбирается в свой набор вместе с partials
+//
+// Страница вызывается по имени шаблона из {{define}}, поэтому одинаковые имена
+// блоков вроде "content" в разных страницах друг другу не мешают.
+//
+// Во всех шаблонах доступна функция cspNonce — nonce политики CSP текущего ответа
+// для встроенных <script> и <style>: <script nonce="{{cspNonce}}">.
+package views
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry — разобранные шаблоны страниц
+type Registry struct {
+	fsys        fs.FS
+	funcs       template.FuncMap
+	dev         bool
+	placeholder string // выводится cspNonce, в Render заменяется на nonce запроса
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+	stamp string
+}
+
+// New разбирает все шаблоны из fsys. При dev == true перед каждым рендерингом
+// проверяется время изменения файлов и шаблоны при необходимости перечитываются.
+func New(fsys fs.FS, funcs template.FuncMap, dev bool) (*Registry, error) {
+	r := &Registry{fsys: fsys, dev: dev, placeholder: newNoncePlaceholder()}
+	r.funcs = template.FuncMap{"cspNonce": func() string { return r.placeholder }}
+	for name, fn := range funcs {
+		r.funcs[name] = fn
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// load разбирает partials и страницы и атомарно подменяет набор шаблонов
+func (r *Registry) load() error {
+	stamp, err := r.modStamp()
+	if err != nil {
+		return err
+	}
+
+	shared := template.New("").Funcs(r.funcs)
+	partials, err := fs.Glob(r.fsys, "partials/*.html")
+	if err != nil {
+		return err
+	}
+	if len(partials) > 0 {
+		if shared, err = shared.ParseFS(r.fsys, partials...); err != nil {
+			return err
+		}
+	}
+	sharedNames := make(map[string]bool)
+	for _, t := range shared.Templates() {
+		sharedNames[t.Name()] = true
+	}
+
+	files, err := fs.Glob(r.fsys, "*.html")
+	if err != nil {
+		return err
+	}
+	pages := make(map[string]*template.Template)
+	for _, file := range files {
+		t, err := shared.Clone()
+		if err != nil {
+			return err
+		}
+		if t, err = t.ParseFS(r.fsys, file); err != nil {
+			return err
+		}
+		// Страница доступна по каждому своему {{define}}, кроме переопределённых блоков макета
+		for _, def := range t.Templates() {
+			name := def.Name()
+			if name == "" || name == path.Base(file) || sharedNames[name] {
+				continue
+			}
+			if _, dup := pages[name]; dup {
+				return fmt.Errorf("шаблон %q определён в нескольких страницах", name)
+			}
+			pages[name] = t
+		}
+	}
+
+	r.mu.Lock()
+	r.pages = pages
+	r.stamp = stamp
+	r.mu.Unlock()
+	return nil
+}
+
+// modStamp — отпечаток каталога шаблонов: число файлов и самое позднее время изменения.
+// Меняется при правке, добавлении и удалении файла.
+func (r *Registry) modStamp() (string, error) {
+	var latest time.Time
+	n := 0
+	for _, pattern := range []string{"*.html", "partials/*.html"} {
+		files, err := fs.Glob(r.fsys, pattern)
+		if err != nil {
+			return "", err
+		}
+		for _, file := range files {
+			info, err := fs.Stat(r.fsys, file)
+			if err != nil {
+				return "", err
+			}
+			if info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+			n++
+		}
+	}
+	return fmt.Sprintf("%d/%d", n, latest.UnixNano()), nil
+}
+
+// reloadIfChanged перечитывает шаблоны, если файлы изменились с прошлого разбора
+func (r *Registry) reloadIfChanged() error {
+	stamp, err := r.modStamp()
+	if err != nil {
+		return err
+	}
+	r.mu.RLock()
+	changed := stamp != r.stamp
+	r.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	slog.Info("templates changed, reloading")
+	return r.load()
+}
+
+// Names — имена всех страниц по алфавиту
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.pages))
+	for name := range r.pages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render выполняет шаблон name в буфер и только затем пишет ответ с кодом status:
+// при ошибке клиент получает 500, а не обрезанную страницу. Из req берётся nonce CSP.
+// Без реестра (nil) отвечает простым текстом 500.
+func (r *Registry) Render(w http.ResponseWriter, req *http.Request, status int, name string, data any) {
+	if r == nil {
+		http.Error(w, statusMessage(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if r.dev {
+		if err := r.reloadIfChanged(); err != nil {
+			r.fail(w, req, "template reload failed", name, err)
+			return
+		}
+	}
+
+	r.mu.RLock()
+	t := r.pages[name]
+	r.mu.RUnlock()
+	if t == nil {
+		r.fail(w, req, "template not found", name, fmt.Errorf("шаблон %q не найден", name))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, name, data); err != nil {
+		r.fail(w, req, "template failed", name, err)
+		return
+	}
+	page := bytes.ReplaceAll(buf.Bytes(), []byte(r.placeholder), []byte(Nonce(req.Context())))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(page)
+}
+
+// fail отвечает 500, когда страницу не удалось построить. Причина всегда уходит в журнал,
+// а клиенту показывается только в режиме разработки (SITE_DEV) — там она нужна прямо в браузере.
+func (r *Registry) fail(w http.ResponseWriter, req *http.Request, msg, name string, err error) {
+	slog.Error(msg, "request_id", RequestID(req.Context()), "template", name, "err", err)
+	text := statusMessage(http.StatusInternalServerError)
+	if r.dev {
+		text += ": " + err.Error()
+	}
+	http.Error(w, text, http.StatusInternalServerError)
+}
+
+type registryKey struct{}
+
+// WithRegistry сохраняет в контексте запроса реестр, которым рендерятся страницы
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, r)
+}
+
+// FromContext — реестр шаблонов запроса или nil
+func FromContext(ctx context.Context) *Registry {
+	r, _ := ctx.Value(registryKey{}).(*Registry)
+	return r
+}